@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/tamararankovic/hidera_eval/configfile"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DEFAULT_CONFIG_FILE = configfile.DEFAULT_CONFIG_FILE
+	CONFIG_ENV_PREFIX   = configfile.ENV_PREFIX
+)
+
+// Config is the part of the hidera.yaml config of run that analyze uses.
+// Settings are overridden by HIDERA_<SETTING> env vars.
+type Config struct {
+	ExperimentsDir string `yaml:"experiments_dir"`
+	ProtocolsFile  string `yaml:"protocols_file"`
+
+	ConvergenceEpsilon float64 `yaml:"convergence_epsilon"`
+	ResampleResolution string  `yaml:"resample_resolution"`
+	ResampleMethod     string  `yaml:"resample_method"`
+}
+
+// loadConfig reads the config file named by HIDERA_CONFIG, or hidera.yaml
+// in this or the parent directory if there is one.
+func loadConfig() (Config, error) {
+	config := Config{
+		ExperimentsDir:     EXPERIMENT_DATA_BASE_PATH,
+		ConvergenceEpsilon: DEFAULT_CONVERGENCE_EPSILON,
+		ResampleResolution: DEFAULT_RESAMPLE_RESOLUTION,
+		ResampleMethod:     RESAMPLE_STEP,
+	}
+
+	content, path, err := configfile.Read("")
+	if err != nil {
+		return config, err
+	}
+	if content != nil {
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return config, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	if value := os.Getenv(CONFIG_ENV_PREFIX + "EXPERIMENTS_DIR"); value != "" {
+		config.ExperimentsDir = value
+	}
+	if value := os.Getenv(CONFIG_ENV_PREFIX + "PROTOCOLS_FILE"); value != "" {
+		config.ProtocolsFile = value
+	}
+	if value := os.Getenv(CONFIG_ENV_PREFIX + "RESAMPLE_RESOLUTION"); value != "" {
+		config.ResampleResolution = value
+	}
+	if value := os.Getenv(CONFIG_ENV_PREFIX + "RESAMPLE_METHOD"); value != "" {
+		config.ResampleMethod = value
+	}
+	if value := os.Getenv(CONFIG_ENV_PREFIX + "CONVERGENCE_EPSILON"); value != "" {
+		epsilon, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return config, fmt.Errorf("%sCONVERGENCE_EPSILON: %w", CONFIG_ENV_PREFIX, err)
+		}
+		config.ConvergenceEpsilon = epsilon
+	}
+	if config.ConvergenceEpsilon <= 0 {
+		return config, fmt.Errorf("convergence epsilon %v is not positive", config.ConvergenceEpsilon)
+	}
+	if config.ExperimentsDir == "" {
+		config.ExperimentsDir = EXPERIMENT_DATA_BASE_PATH
+	}
+	return config, nil
+}
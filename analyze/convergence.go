@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const (
+	DEFAULT_CONVERGENCE_EPSILON = 0.05
+	// STEADY_STATE_FRACTION is the tail of a phase whose error is the
+	// steady-state error of the phase.
+	STEADY_STATE_FRACTION = 0.2
+)
+
+// convergenceMetrics are the metrics of a phase, in the column order of the
+// convergence CSVs.
+var convergenceMetrics = []string{"reach_s", "settling_s", "overshoot", "steady_state_error"}
+
+// phase is the part of a repetition that a single ground truth holds for:
+// the start, up to the first event, and every event up to the next one.
+// Occurrence counts the phases of the same name so far, from 1.
+type phase struct {
+	Name       string
+	Occurrence int
+	Event      *EventMetadata
+	Start      int64
+	End        int64
+}
+
+func repetitionPhases(metadata *ExperimentRunMetadata) []phase {
+	events := append([]*EventMetadata{}, metadata.Events...)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventTs < events[j].EventTs
+	})
+
+	phases := []phase{{Name: "start", Occurrence: 1, Start: metadata.StartExperimentTs}}
+	occurrences := map[string]int{}
+	for _, event := range events {
+		occurrences[event.Name]++
+		phases[len(phases)-1].End = event.EventTs
+		phases = append(phases, phase{Name: event.Name, Occurrence: occurrences[event.Name], Event: event, Start: event.EventTs})
+	}
+	phases[len(phases)-1].End = metadata.StopExperimentTs
+	return phases
+}
+
+// PhaseConvergence holds the convergence metrics of a phase of a repetition.
+// Metrics that are undefined, like the settling time of a phase that never
+// settles, are missing.
+//
+//   - reach_s: seconds from the start of the phase until the mean relative
+//     error of node outputs first is within epsilon
+//   - settling_s: seconds until it is within epsilon for the rest of the phase
+//   - overshoot: the largest mean excursion of node outputs beyond the new
+//     ground truth, as a fraction of the step an event made (events only)
+//   - steady_state_error: the mean relative error over the last
+//     STEADY_STATE_FRACTION of the phase
+type PhaseConvergence struct {
+	Protocol   string             `json:"protocol"`
+	Repetition int                `json:"repetition"`
+	Phase      int                `json:"phase"`
+	Name       string             `json:"event"`
+	Occurrence int                `json:"occurrence"`
+	Start      float64            `json:"start_s"`
+	Metrics    map[string]float64 `json:"metrics"`
+}
+
+// ConvergenceSummary is a metric of a phase across the repetitions of a
+// protocol. Phases are matched across repetitions by event and occurrence,
+// not by position, since random events and churn make the phase sequences
+// of repetitions differ.
+type ConvergenceSummary struct {
+	Protocol   string `json:"protocol"`
+	Name       string `json:"event"`
+	Occurrence int    `json:"occurrence"`
+	Metric     string `json:"metric"`
+	Stats
+}
+
+// phaseKey matches the phases of different repetitions.
+type phaseKey struct {
+	Name       string
+	Occurrence int
+}
+
+// repetitionConvergence judges every node output against the ground truth of
+// its phase and derives the convergence metrics of each phase from the mean
+// error of all nodes at every timestamp.
+func repetitionConvergence(repetition *RepetitionData, epsilon float64) []PhaseConvergence {
+	metadata := repetition.Metadata
+	phases := repetitionPhases(metadata)
+	phaseOf := map[*EventMetadata]int{}
+	relSum := make([]map[int64]float64, len(phases))
+	count := make([]map[int64]int64, len(phases))
+	overshootSum := make([]map[int64]float64, len(phases))
+	overshootCount := make([]map[int64]int64, len(phases))
+	for i, p := range phases {
+		phaseOf[p.Event] = i
+		relSum[i] = map[int64]float64{}
+		count[i] = map[int64]int64{}
+		overshootSum[i] = map[int64]float64{}
+		overshootCount[i] = map[int64]int64{}
+	}
+
+	for nodeName, nodeData := range repetition.Nodes {
+		for _, point := range nodeData.Values {
+			expected, ok := expectedValueAt(metadata, nodeName, point.Timestamp)
+			if !ok {
+				continue
+			}
+			// an event only holds after its timestamp, so the grid point of an
+			// event is judged against the ground truth before it and counts
+			// for the phase before it
+			i := phaseOf[findActiveEvent(point.Timestamp, metadata.Events)]
+			if rel := relativeError(point.Value, expected); !math.IsNaN(rel) {
+				relSum[i][point.Timestamp] += rel
+				count[i][point.Timestamp]++
+			}
+
+			if phases[i].Event == nil {
+				continue
+			}
+			previous, ok := expectedValueAt(metadata, nodeName, phases[i].Start)
+			if !ok || previous == expected {
+				continue
+			}
+			overshootSum[i][point.Timestamp] += (point.Value - expected) / (expected - previous)
+			overshootCount[i][point.Timestamp]++
+		}
+	}
+
+	results := []PhaseConvergence{}
+	for i, p := range phases {
+		timestamps := mapKeysInt64(count[i])
+		sort.Slice(timestamps, func(a, b int) bool {
+			return timestamps[a] < timestamps[b]
+		})
+		metrics := map[string]float64{}
+
+		settled := -1
+		for j, ts := range timestamps {
+			mre := relSum[i][ts] / float64(count[i][ts])
+			if mre > epsilon {
+				settled = -1
+				continue
+			}
+			if _, ok := metrics["reach_s"]; !ok {
+				metrics["reach_s"] = seconds(ts - p.Start)
+			}
+			if settled < 0 {
+				settled = j
+			}
+		}
+		if settled >= 0 {
+			metrics["settling_s"] = seconds(timestamps[settled] - p.Start)
+		}
+
+		tailStart := float64(p.End) - float64(p.End-p.Start)*STEADY_STATE_FRACTION
+		tail := []float64{}
+		for _, ts := range timestamps {
+			if float64(ts) >= tailStart {
+				tail = append(tail, relSum[i][ts]/float64(count[i][ts]))
+			}
+		}
+		if len(tail) > 0 {
+			metrics["steady_state_error"], _ = meanStdDev(tail)
+		}
+
+		if len(overshootCount[i]) > 0 {
+			overshoot := 0.0
+			for ts, n := range overshootCount[i] {
+				if excursion := overshootSum[i][ts] / float64(n); excursion > overshoot {
+					overshoot = excursion
+				}
+			}
+			metrics["overshoot"] = overshoot
+		}
+
+		results = append(results, PhaseConvergence{
+			Repetition: metadata.Repetition,
+			Phase:      i,
+			Name:       p.Name,
+			Occurrence: p.Occurrence,
+			Start:      seconds(p.Start),
+			Metrics:    metrics,
+		})
+	}
+	return results
+}
+
+// makeConvergenceMetrics writes the convergence metrics of every phase of
+// every repetition to <protocol>_convergence.csv, and their mean, standard
+// deviation and 95% confidence interval across repetitions to
+// convergence_summary.csv and convergence_summary.json.
+func makeConvergenceMetrics(data map[string]map[string]*RepetitionData, epsilon float64, resolution int64) {
+	allPhases := []PhaseConvergence{}
+	summaries := []ConvergenceSummary{}
+
+	for _, protocol := range protocols {
+		repetitions, ok := data[fmt.Sprintf("%s_%s", experimentName, protocol)]
+		if !ok || len(repetitions) == 0 {
+			continue
+		}
+
+		phases := []PhaseConvergence{}
+		for _, repetition := range repetitions {
+			for _, p := range repetitionConvergence(repetition, epsilon) {
+				p.Protocol = protocol
+				phases = append(phases, p)
+			}
+		}
+		sort.Slice(phases, func(i, j int) bool {
+			if phases[i].Repetition != phases[j].Repetition {
+				return phases[i].Repetition < phases[j].Repetition
+			}
+			return phases[i].Phase < phases[j].Phase
+		})
+
+		rows := [][]string{append([]string{"repetition", "phase", "event", "occurrence", "start_s"}, convergenceMetrics...)}
+		values := map[phaseKey]map[string][]float64{}
+		// keys are summarized in the order their phases first come in
+		firstPhase := map[phaseKey]int{}
+		for _, p := range phases {
+			row := []string{strconv.Itoa(p.Repetition), strconv.Itoa(p.Phase), p.Name, strconv.Itoa(p.Occurrence), strconv.FormatFloat(p.Start, 'f', 3, 64)}
+			key := phaseKey{Name: p.Name, Occurrence: p.Occurrence}
+			if values[key] == nil {
+				values[key] = map[string][]float64{}
+				firstPhase[key] = p.Phase
+			} else if p.Phase < firstPhase[key] {
+				firstPhase[key] = p.Phase
+			}
+			for _, metric := range convergenceMetrics {
+				value, ok := p.Metrics[metric]
+				if !ok {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, strconv.FormatFloat(value, 'f', 6, 64))
+				values[key][metric] = append(values[key][metric], value)
+			}
+			rows = append(rows, row)
+		}
+		writeRowsToCSV(fmt.Sprintf("%s/%s_convergence.csv", dirPath, protocol), rows)
+		allPhases = append(allPhases, phases...)
+
+		keys := []phaseKey{}
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if firstPhase[keys[i]] != firstPhase[keys[j]] {
+				return firstPhase[keys[i]] < firstPhase[keys[j]]
+			}
+			if keys[i].Name != keys[j].Name {
+				return keys[i].Name < keys[j].Name
+			}
+			return keys[i].Occurrence < keys[j].Occurrence
+		})
+		for _, key := range keys {
+			for _, metric := range convergenceMetrics {
+				if len(values[key][metric]) == 0 {
+					continue
+				}
+				summaries = append(summaries, ConvergenceSummary{
+					Protocol:   protocol,
+					Name:       key.Name,
+					Occurrence: key.Occurrence,
+					Metric:     metric,
+					Stats:      newStats(values[key][metric]),
+				})
+			}
+		}
+	}
+
+	if len(allPhases) == 0 {
+		return
+	}
+
+	rows := [][]string{{"protocol", "event", "occurrence", "metric", "n", "mean", "stddev", "ci95_low", "ci95_high"}}
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			s.Protocol,
+			s.Name,
+			strconv.Itoa(s.Occurrence),
+			s.Metric,
+			strconv.Itoa(s.N),
+			strconv.FormatFloat(s.Mean, 'f', 6, 64),
+			strconv.FormatFloat(s.StdDev, 'f', 6, 64),
+			strconv.FormatFloat(s.CI95Low, 'f', 6, 64),
+			strconv.FormatFloat(s.CI95Hi, 'f', 6, 64),
+		})
+	}
+	writeRowsToCSV(fmt.Sprintf("%s/convergence_summary.csv", dirPath), rows)
+
+	summaryJson, err := json.MarshalIndent(map[string]interface{}{
+		"epsilon":               epsilon,
+		"steady_state_fraction": STEADY_STATE_FRACTION,
+		"resolution_ms":         resolution,
+		"summary":               summaries,
+		"repetitions":           allPhases,
+	}, "", "  ")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = os.WriteFile(fmt.Sprintf("%s/convergence_summary.json", dirPath), summaryJson, 0666)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// relativeError scales the error by the expected value, so errors of
+// aggregates that grow with the size of the network, like SUM and COUNT,
+// stay comparable. It is NaN when nothing is expected, and such outputs are
+// left out of every relative error; their absolute error still counts.
+func relativeError(value, expected float64) float64 {
+	if expected == 0 {
+		return math.NaN()
+	}
+	return math.Abs(value-expected) / math.Abs(expected)
+}
+
+// formatRelativeError leaves the relative error empty when none of the
+// outputs it summarizes had one.
+func formatRelativeError(value float64, n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', 6, 64)
+}
+
+// expectedValueAt returns the ground truth of a node at a point in time and
+// false if the node's output doesn't count at that time.
+func expectedValueAt(metadata *ExperimentRunMetadata, nodeName string, timestamp int64) (float64, bool) {
+	event := findActiveEvent(timestamp, metadata.Events)
+	if event == nil {
+		return metadata.Job.ExpectedValue, true
+	}
+	if containsString(event.ExcludeNodes, nodeName) {
+		return 0, false
+	}
+	return event.ExpectedValueOf(nodeName), true
+}
+
+// ERROR_CDF_POINTS is the number of steps of the error CDFs.
+const ERROR_CDF_POINTS = 100
+
+// makeErrorSeries writes, for every protocol, the error of node outputs at
+// every timestamp, each output judged against the ground truth of the
+// protocol's own aggregate:
+//
+//   - <protocol>_error.csv: timestamp, mean absolute and mean relative error
+//   - <protocol>_error_stats.csv: timestamp, number of outputs, RMSE, p50,
+//     p90, p99 and max of the absolute error, p50, p90, p99 and max of the
+//     relative error, and the fraction of outputs with a relative error
+//     that are within tolerance
+//   - <protocol>_error_cdf.csv: cumulative fraction, absolute and relative
+//     error at that fraction of all outputs of the run
+func makeErrorSeries(data map[string]map[string]*RepetitionData, tolerance float64) {
+	for protocol, repetitions := range data {
+		absErrors := map[int64][]float64{}
+		relErrors := map[int64][]float64{}
+
+		for _, repetition := range repetitions {
+			for nodeName, nodeData := range repetition.Nodes {
+				for _, point := range nodeData.Values {
+					expected, ok := expectedValueAt(repetition.Metadata, nodeName, point.Timestamp)
+					if !ok {
+						continue
+					}
+					absErrors[point.Timestamp] = append(absErrors[point.Timestamp], math.Abs(point.Value-expected))
+					if rel := relativeError(point.Value, expected); !math.IsNaN(rel) {
+						relErrors[point.Timestamp] = append(relErrors[point.Timestamp], rel)
+					}
+				}
+			}
+		}
+
+		if len(absErrors) == 0 {
+			continue
+		}
+
+		timestamps := mapKeysInt64(absErrors)
+		sort.Slice(timestamps, func(i, j int) bool {
+			return timestamps[i] < timestamps[j]
+		})
+
+		rows := [][]string{}
+		statsRows := [][]string{}
+		allAbs := []float64{}
+		allRel := []float64{}
+		for _, ts := range timestamps {
+			abs := absErrors[ts]
+			rel := relErrors[ts]
+			sort.Float64s(abs)
+			sort.Float64s(rel)
+			allAbs = append(allAbs, abs...)
+			allRel = append(allRel, rel...)
+
+			absSum, squareSum := 0.0, 0.0
+			for _, e := range abs {
+				absSum += e
+				squareSum += e * e
+			}
+			relSum := 0.0
+			within := 0
+			for _, e := range rel {
+				relSum += e
+				if e <= tolerance {
+					within++
+				}
+			}
+			n := float64(len(abs))
+			relMax, withinFraction := 0.0, ""
+			if len(rel) > 0 {
+				relMax = rel[len(rel)-1]
+				withinFraction = strconv.FormatFloat(float64(within)/float64(len(rel)), 'f', 4, 64)
+			}
+
+			rows = append(rows, []string{
+				formatTimestamp(ts),
+				strconv.FormatFloat(absSum/n, 'f', 4, 64),
+				formatRelativeError(relSum/float64(len(rel)), len(rel)),
+			})
+			statsRows = append(statsRows, []string{
+				formatTimestamp(ts),
+				strconv.Itoa(len(abs)),
+				strconv.FormatFloat(math.Sqrt(squareSum/n), 'f', 4, 64),
+				strconv.FormatFloat(percentile(abs, 50), 'f', 4, 64),
+				strconv.FormatFloat(percentile(abs, 90), 'f', 4, 64),
+				strconv.FormatFloat(percentile(abs, 99), 'f', 4, 64),
+				strconv.FormatFloat(abs[len(abs)-1], 'f', 4, 64),
+				formatRelativeError(percentile(rel, 50), len(rel)),
+				formatRelativeError(percentile(rel, 90), len(rel)),
+				formatRelativeError(percentile(rel, 99), len(rel)),
+				formatRelativeError(relMax, len(rel)),
+				withinFraction,
+			})
+		}
+
+		sort.Float64s(allAbs)
+		sort.Float64s(allRel)
+		cdfRows := [][]string{}
+		for i := 0; i <= ERROR_CDF_POINTS; i++ {
+			p := 100 * float64(i) / ERROR_CDF_POINTS
+			cdfRows = append(cdfRows, []string{
+				strconv.FormatFloat(p/100, 'f', 2, 64),
+				strconv.FormatFloat(percentile(allAbs, p), 'f', 4, 64),
+				formatRelativeError(percentile(allRel, p), len(allRel)),
+			})
+		}
+
+		parts := strings.Split(protocol, "_")
+		protocolName := parts[len(parts)-1]
+		writeRowsToCSV(fmt.Sprintf("%s/%s_error.csv", dirPath, protocolName), rows)
+		writeRowsToCSV(fmt.Sprintf("%s/%s_error_stats.csv", dirPath, protocolName), statsRows)
+		writeRowsToCSV(fmt.Sprintf("%s/%s_error_cdf.csv", dirPath, protocolName), cdfRows)
+	}
+}
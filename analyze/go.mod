@@ -1,3 +1,10 @@
 module github.com/tamararankovic/hidera_eval/analyze
 
 go 1.19
+
+require (
+	github.com/tamararankovic/hidera_eval/configfile v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/tamararankovic/hidera_eval/configfile => ../configfile
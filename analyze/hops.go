@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func loadGraphMetrics(path string) *GraphMetrics {
+	graphJson, err := os.ReadFile(path)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	var graph GraphMetrics
+	err = json.Unmarshal(graphJson, &graph)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return &graph
+}
+
+// makeErrorByHop writes the mean absolute and relative error of every node,
+// across all repetitions, next to its hop distance from the root, and the
+// same errors averaged over all nodes at each hop distance.
+func makeErrorByHop(data map[string]map[string]*RepetitionData) {
+	for protocol, repetitions := range data {
+		errorSum := map[string]float64{}
+		relErrorSum := map[string]float64{}
+		errorCount := map[string]int64{}
+		relErrorCount := map[string]int{}
+		hops := map[string]int{}
+
+		for _, repetition := range repetitions {
+			if repetition.Graph == nil {
+				continue
+			}
+			for nodeName, nodeData := range repetition.Nodes {
+				hop, ok := repetition.Graph.HopDistance[nodeName]
+				if !ok {
+					continue
+				}
+				hops[nodeName] = hop
+				for _, point := range nodeData.Values {
+					expected, ok := expectedValueAt(repetition.Metadata, nodeName, point.Timestamp)
+					if !ok {
+						continue
+					}
+					errorSum[nodeName] += math.Abs(point.Value - expected)
+					if rel := relativeError(point.Value, expected); !math.IsNaN(rel) {
+						relErrorSum[nodeName] += rel
+						relErrorCount[nodeName]++
+					}
+					errorCount[nodeName]++
+				}
+			}
+		}
+
+		if len(errorCount) == 0 {
+			continue
+		}
+
+		parts := strings.Split(protocol, "_")
+		protocolName := parts[len(parts)-1]
+
+		nodeNames := make([]string, 0, len(errorCount))
+		for nodeName := range errorCount {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Slice(nodeNames, func(i, j int) bool {
+			if hops[nodeNames[i]] != hops[nodeNames[j]] {
+				return hops[nodeNames[i]] < hops[nodeNames[j]]
+			}
+			return nodeNames[i] < nodeNames[j]
+		})
+
+		hopErrorSum := map[int]float64{}
+		hopRelErrorSum := map[int]float64{}
+		hopNodes := map[int]int64{}
+		hopRelNodes := map[int]int{}
+		nodeRows := [][]string{}
+		for _, nodeName := range nodeNames {
+			mae := errorSum[nodeName] / float64(errorCount[nodeName])
+			mre := relErrorSum[nodeName] / float64(relErrorCount[nodeName])
+			hop := hops[nodeName]
+			hopErrorSum[hop] += mae
+			hopNodes[hop]++
+			if relErrorCount[nodeName] > 0 {
+				hopRelErrorSum[hop] += mre
+				hopRelNodes[hop]++
+			}
+			nodeRows = append(nodeRows, []string{
+				nodeName,
+				strconv.Itoa(hop),
+				strconv.FormatFloat(mae, 'f', 4, 64),
+				formatRelativeError(mre, relErrorCount[nodeName]),
+			})
+		}
+		writeRowsToCSV(fmt.Sprintf("%s/%s_error_by_node.csv", dirPath, protocolName), nodeRows)
+
+		hopValues := make([]int, 0, len(hopNodes))
+		for hop := range hopNodes {
+			hopValues = append(hopValues, hop)
+		}
+		sort.Ints(hopValues)
+
+		hopRows := [][]string{}
+		for _, hop := range hopValues {
+			hopRows = append(hopRows, []string{
+				strconv.Itoa(hop),
+				strconv.FormatInt(hopNodes[hop], 10),
+				strconv.FormatFloat(hopErrorSum[hop]/float64(hopNodes[hop]), 'f', 4, 64),
+				formatRelativeError(hopRelErrorSum[hop]/float64(hopRelNodes[hop]), hopRelNodes[hop]),
+			})
+		}
+		writeRowsToCSV(fmt.Sprintf("%s/%s_error_by_hop.csv", dirPath, protocolName), hopRows)
+	}
+}
+
+func writeRowsToCSV(filename string, rows [][]string) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	err = w.WriteAll(rows)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -11,13 +11,10 @@ import (
 	"strings"
 )
 
-const EXPERIMENT_DATA_BASE_PATH = "/home/tamara/experiments"
-
-// const EXPERIMENT_DATA_BASE_PATH = "/Users/tamararankovic/Documents/monitoring/impl/hidera_eval/tmp"
-
-var protocols = []string{"hi", "fu", "ep", "dd", "rr"}
+const EXPERIMENT_DATA_BASE_PATH = "../experiments"
 
 var experimentName = ""
+var experimentsDirPath = ""
 var dirPath = ""
 
 type ValueRow struct {
@@ -27,12 +24,13 @@ type ValueRow struct {
 
 type MsgCountRow struct {
 	Timestamp int64
-	Sent      int64
-	Rcvd      int64
+	Sent      float64
+	Rcvd      float64
 }
 
 type RepetitionData struct {
 	Metadata *ExperimentRunMetadata
+	Graph    *GraphMetrics
 	Nodes    map[string]*NodeData
 }
 
@@ -43,12 +41,28 @@ type NodeData struct {
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run . <experiment-name>")
+		log.Fatal("Usage: go run . <experiment-name> [<experiments-dir>]")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := loadProtocolRegistry(config.ProtocolsFile); err != nil {
+		log.Fatal(err)
+	}
+	resolution, err := parseResampling(config.ResampleResolution, config.ResampleMethod)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	experimentName = os.Args[1]
-	dirPath = fmt.Sprintf("%s/%s_analyzed", EXPERIMENT_DATA_BASE_PATH, experimentName)
-	err := os.MkdirAll(dirPath, 0777)
+	experimentsDirPath = config.ExperimentsDir
+	if len(os.Args) > 2 {
+		experimentsDirPath = os.Args[2]
+	}
+	dirPath = fmt.Sprintf("%s/%s_analyzed", experimentsDirPath, experimentName)
+	err = os.MkdirAll(dirPath, 0777)
 	if err != nil {
 		log.Println(err)
 		return
@@ -56,20 +70,30 @@ func main() {
 
 	files := findExperimentFiles()
 	data := loadExperimentData(files)
-	preprocess(data)
+	preprocess(data, resolution, config.ResampleMethod)
+	writeResampling(resolution, config.ResampleMethod)
+	writeProtocolRegistry()
+
+	writeSweepParams(data)
 
 	makeExpectedValueSeries(data)
 
 	makeValuesSeries(data)
 
 	makeMsgCountAndRate(data)
+
+	makeErrorSeries(data, config.ConvergenceEpsilon)
+
+	makeErrorByHop(data)
+
+	makeConvergenceMetrics(data, config.ConvergenceEpsilon, resolution)
 }
 
 func findExperimentFiles() map[string]map[string][]string {
 	experimentData := map[string]map[string][]string{}
 
 	for _, protocol := range protocols {
-		experimentDirPath := fmt.Sprintf("%s/%s_%s", EXPERIMENT_DATA_BASE_PATH, experimentName, protocol)
+		experimentDirPath := fmt.Sprintf("%s/%s_%s", experimentsDirPath, experimentName, protocol)
 
 		if !dirExists(experimentDirPath) {
 			continue
@@ -112,7 +136,7 @@ func loadExperimentData(files map[string]map[string][]string) map[string]map[str
 	for protocol, repetitions := range files {
 		data[protocol] = make(map[string]*RepetitionData)
 		for repetition, nodes := range repetitions {
-			metadataJson, err := os.ReadFile(fmt.Sprintf("%s/%s/%s/metadata.json", EXPERIMENT_DATA_BASE_PATH, protocol, repetition))
+			metadataJson, err := os.ReadFile(fmt.Sprintf("%s/%s/%s/metadata.json", experimentsDirPath, protocol, repetition))
 			if err != nil {
 				log.Println(err)
 				continue
@@ -123,8 +147,13 @@ func loadExperimentData(files map[string]map[string][]string) map[string]map[str
 				log.Println(err)
 				continue
 			}
+			if metadata.Aborted {
+				log.Printf("Skipping aborted repetition %s of %s\n", repetition, protocol)
+				continue
+			}
 			data[protocol][repetition] = &RepetitionData{
 				Metadata: &metadata,
+				Graph:    loadGraphMetrics(fmt.Sprintf("%s/%s/%s/graph.json", experimentsDirPath, protocol, repetition)),
 				Nodes:    make(map[string]*NodeData),
 			}
 			for _, nodeDirPath := range nodes {
@@ -153,27 +182,32 @@ func loadExperimentData(files map[string]map[string][]string) map[string]map[str
 	return data
 }
 
-func preprocess(data map[string]map[string]*RepetitionData) {
-	timestampsToSeconds(data)
+// preprocess brings all series onto one timeline: milliseconds since the
+// start of their repetition, with the first events of all repetitions
+// aligned, on the resampling grid.
+func preprocess(data map[string]map[string]*RepetitionData, resolution int64, method string) {
+	timestampsToMilliseconds(data)
 	normalizeTime(data)
+	alignEvents(data)
+	resample(data, resolution, method)
 }
 
-func timestampsToSeconds(data map[string]map[string]*RepetitionData) {
+func timestampsToMilliseconds(data map[string]map[string]*RepetitionData) {
 	for _, repetitions := range data {
 		for _, repetition := range repetitions {
-			repetition.Metadata.StartExperimentTs /= 1_000_000_000
-			repetition.Metadata.StartEventsTs /= 1_000_000_000
-			repetition.Metadata.StopEventsTs /= 1_000_000_000
-			repetition.Metadata.StopExperimentTs /= 1_000_000_000
+			repetition.Metadata.StartExperimentTs /= 1_000_000
+			repetition.Metadata.StartEventsTs /= 1_000_000
+			repetition.Metadata.StopEventsTs /= 1_000_000
+			repetition.Metadata.StopExperimentTs /= 1_000_000
 			for _, event := range repetition.Metadata.Events {
-				event.EventTs /= 1_000_000_000
+				event.EventTs /= 1_000_000
 			}
 			for _, node := range repetition.Nodes {
 				for _, row := range node.Values {
-					row.Timestamp /= 1_000_000_000
+					row.Timestamp /= 1_000_000
 				}
 				for _, row := range node.MsgCounts {
-					row.Timestamp /= 1_000_000_000
+					row.Timestamp /= 1_000_000
 				}
 			}
 		}
@@ -215,242 +249,277 @@ func normalizeTime(data map[string]map[string]*RepetitionData) {
 	}
 }
 
-func makeExpectedValueSeries(data map[string]map[string]*RepetitionData) {
-	var node *NodeData
-	var metadata *ExperimentRunMetadata
+// alignEvents shifts every repetition so that its first event happens when
+// the latest first event of all repetitions of all protocols does. Nodes take
+// longer to get ready in some repetitions than in others, and without the
+// shift averaging repetitions would smear every event over several seconds.
+func alignEvents(data map[string]map[string]*RepetitionData) {
+	anchor := int64(0)
+	firstEventTs := map[*RepetitionData]int64{}
 	for _, repetitions := range data {
-		node, metadata = findReferencePoint(repetitions)
-	}
-	if node == nil || metadata == nil {
-		return
+		for _, repetition := range repetitions {
+			for _, event := range repetition.Metadata.Events {
+				if ts, ok := firstEventTs[repetition]; !ok || event.EventTs < ts {
+					firstEventTs[repetition] = event.EventTs
+				}
+			}
+			if ts, ok := firstEventTs[repetition]; ok && ts > anchor {
+				anchor = ts
+			}
+		}
 	}
 
-	expectedValues := make([]*ValueRow, 0)
-	for _, point := range node.Values {
-		value := &ValueRow{
-			Timestamp: point.Timestamp,
+	for repetition, ts := range firstEventTs {
+		shift := anchor - ts
+		repetition.Metadata.StartExperimentTs += shift
+		repetition.Metadata.StartEventsTs += shift
+		repetition.Metadata.StopEventsTs += shift
+		repetition.Metadata.StopExperimentTs += shift
+		for _, event := range repetition.Metadata.Events {
+			event.EventTs += shift
 		}
-		activeEvent := findActiveEvent(point.Timestamp, metadata.Events)
-		if activeEvent != nil {
-			value.Value = activeEvent.ExpectedValue
-		} else {
-			value.Value = metadata.Job.ExpectedValue
+		for _, node := range repetition.Nodes {
+			for _, row := range node.Values {
+				row.Timestamp += shift
+			}
+			for _, row := range node.MsgCounts {
+				row.Timestamp += shift
+			}
 		}
-		expectedValues = append(expectedValues, value)
 	}
-	filename := fmt.Sprintf("%s/value_expected.csv", dirPath)
-	writeValuesToCSV(filename, expectedValues)
 }
 
-func makeValuesSeries(data map[string]map[string]*RepetitionData) {
-	var node *NodeData
+// writeSweepParams records which sweep the experiment was expanded from, so
+// analyzed results can be grouped by swept parameter.
+func writeSweepParams(data map[string]map[string]*RepetitionData) {
 	var metadata *ExperimentRunMetadata
 	for _, repetitions := range data {
-		node, metadata = findReferencePoint(repetitions)
+		for _, repetition := range repetitions {
+			if repetition.Metadata.Job.SweepName != "" {
+				metadata = repetition.Metadata
+			}
+		}
 	}
-	if node == nil || metadata == nil {
+	if metadata == nil {
 		return
 	}
 
-	values := make(map[string]map[string][]*ValueRow)
-	averagedValues := make(map[string][]*ValueRow)
+	sweep := map[string]interface{}{
+		"sweep_name":   metadata.Job.SweepName,
+		"sweep_params": metadata.Job.SweepParams,
+	}
+	sweepJson, err := json.Marshal(sweep)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = os.WriteFile(fmt.Sprintf("%s/sweep.json", dirPath), sweepJson, 0666)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// makeExpectedValueSeries writes the ground truth over time. Every repetition
+// gets its own from its metadata, at the timestamps its nodes reported at,
+// and these are averaged over the repetitions of a protocol into
+// <protocol>_value_expected.csv and over all repetitions into
+// value_expected.csv. Partitions are drawn anew for every repetition, so the
+// ground truth of side n of the active partition is written per repetition,
+// to <protocol>_<repetition>_value_expected_partition_<n>.csv; the nodes of
+// each side are listed in the metadata.json of the repetition.
+func makeExpectedValueSeries(data map[string]map[string]*RepetitionData) {
+	allSeries := []map[int64]float64{}
 
-	nodeSet := make(map[string]struct{})
 	for protocol, repetitions := range data {
-		values[protocol] = make(map[string][]*ValueRow)
-		averagedValues[protocol] = make([]*ValueRow, 0)
-		for _, repetition := range repetitions {
-			for name := range repetition.Nodes {
-				if _, ok := values[protocol][name]; !ok {
-					values[protocol][name] = []*ValueRow{}
+		parts := strings.Split(protocol, "_")
+		protocolName := parts[len(parts)-1]
+
+		protocolSeries := []map[int64]float64{}
+		for repetitionName, repetition := range repetitions {
+			metadata := repetition.Metadata
+			series := map[int64]float64{}
+			partitions := map[int]map[int64]float64{}
+			for _, node := range repetition.Nodes {
+				for _, point := range node.Values {
+					activeEvent := findActiveEvent(point.Timestamp, metadata.Events)
+					if activeEvent == nil {
+						series[point.Timestamp] = metadata.Job.ExpectedValue
+						continue
+					}
+					series[point.Timestamp] = activeEvent.ExpectedValue
+					for i, partition := range activeEvent.Partitions {
+						if partitions[i] == nil {
+							partitions[i] = map[int64]float64{}
+						}
+						partitions[i][point.Timestamp] = partition.ExpectedValue
+					}
 				}
-				nodeSet[name] = struct{}{}
+			}
+			protocolSeries = append(protocolSeries, series)
+			for i, values := range partitions {
+				filename := fmt.Sprintf("%s/%s_%s_value_expected_partition_%d.csv", dirPath, protocolName, repetitionName, i+1)
+				writeValuesToCSV(filename, meanValueRows([]map[int64]float64{values}))
 			}
 		}
+		allSeries = append(allSeries, protocolSeries...)
+
+		filename := fmt.Sprintf("%s/%s_value_expected.csv", dirPath, protocolName)
+		writeValuesToCSV(filename, meanValueRows(protocolSeries))
 	}
 
-	for protocol, repetitions := range data {
-		totalSum := map[int64]float64{}
-		totalCount := map[int64]int64{}
-		for nodeName := range nodeSet {
+	if len(allSeries) == 0 {
+		return
+	}
+	filename := fmt.Sprintf("%s/value_expected.csv", dirPath)
+	writeValuesToCSV(filename, meanValueRows(allSeries))
+}
 
-			sum := map[int64]float64{}
-			count := map[int64]int64{}
+func meanValueRows(series []map[int64]float64) []*ValueRow {
+	rows := []*ValueRow{}
+	for _, point := range aggregateRepetitions(series) {
+		rows = append(rows, &ValueRow{Timestamp: point.Timestamp, Value: point.Mean})
+	}
+	return rows
+}
 
-			for _, repetition := range repetitions {
-				nodeData, ok := repetition.Nodes[nodeName]
-				if !ok {
-					continue
+// makeValuesSeries writes the output of every node averaged over the
+// repetitions, and the mean output of all nodes computed per repetition
+// first, then summarized across repetitions, so that every repetition weighs
+// the same no matter how many of its nodes survived.
+func makeValuesSeries(data map[string]map[string]*RepetitionData) {
+	for protocol, repetitions := range data {
+		nodeSum := map[string]map[int64]float64{}
+		nodeCount := map[string]map[int64]int64{}
+		repetitionSeries := []map[int64]float64{}
+
+		for _, repetition := range repetitions {
+			sum := map[string]map[int64]float64{}
+			count := map[string]map[int64]int64{}
+			for nodeName, nodeData := range repetition.Nodes {
+				if _, ok := nodeSum[nodeName]; !ok {
+					nodeSum[nodeName] = map[int64]float64{}
+					nodeCount[nodeName] = map[int64]int64{}
 				}
+				sum[nodeName] = map[int64]float64{}
+				count[nodeName] = map[int64]int64{}
 				for _, point := range nodeData.Values {
-					event := findActiveEvent(point.Timestamp, metadata.Events)
+					event := findActiveEvent(point.Timestamp, repetition.Metadata.Events)
 					if event != nil && containsString(event.ExcludeNodes, nodeName) {
 						continue
 					}
-					sum[point.Timestamp] += point.Value
-					count[point.Timestamp]++
-					totalSum[point.Timestamp] += point.Value
-					totalCount[point.Timestamp]++
+					sum[nodeName][point.Timestamp] += point.Value
+					count[nodeName][point.Timestamp]++
+					nodeSum[nodeName][point.Timestamp] += point.Value
+					nodeCount[nodeName][point.Timestamp]++
 				}
 			}
+			repetitionSeries = append(repetitionSeries, meanOfNodes(sum, count))
+		}
 
+		parts := strings.Split(protocol, "_")
+		protocolName := parts[len(parts)-1]
+		filename := fmt.Sprintf("%s/%s_value_averaged.csv", dirPath, protocolName)
+		writeSeriesStatsToCSV(filename, aggregateRepetitions(repetitionSeries))
+
+		for nodeName, sum := range nodeSum {
 			timestamps := mapKeysInt64(sum)
 			sort.Slice(timestamps, func(i, j int) bool {
 				return timestamps[i] < timestamps[j]
 			})
 
+			values := []*ValueRow{}
 			for _, ts := range timestamps {
-				values[protocol][nodeName] = append(
-					values[protocol][nodeName],
-					&ValueRow{
-						Timestamp: ts,
-						Value:     sum[ts] / float64(count[ts]),
-					},
-				)
-			}
-		}
-
-		timestamps := mapKeysInt64(totalSum)
-		sort.Slice(timestamps, func(i, j int) bool {
-			return timestamps[i] < timestamps[j]
-		})
-
-		for _, ts := range timestamps {
-			averagedValues[protocol] = append(
-				averagedValues[protocol],
-				&ValueRow{
+				values = append(values, &ValueRow{
 					Timestamp: ts,
-					Value:     totalSum[ts] / float64(totalCount[ts]),
-				},
-			)
-		}
-	}
-
-	for protocol, nodes := range values {
-		parts := strings.Split(protocol, "_")
-		protocolName := parts[len(parts)-1]
-		filename := fmt.Sprintf("%s/%s_value_averaged.csv", dirPath, protocolName)
-		writeValuesToCSV(filename, averagedValues[protocol])
-		for nodeName, value := range nodes {
+					Value:     sum[ts] / float64(nodeCount[nodeName][ts]),
+				})
+			}
 			filename := fmt.Sprintf("%s/%s_value_%s.csv", dirPath, protocolName, nodeName)
-			writeValuesToCSV(filename, value)
+			writeValuesToCSV(filename, values)
 		}
 	}
 }
 
+// makeMsgCountAndRate writes the message counts and rates of every node
+// averaged over the repetitions, and those of all nodes summarized across
+// repetitions like makeValuesSeries does with values.
 func makeMsgCountAndRate(data map[string]map[string]*RepetitionData) {
-	var node *NodeData
-	var metadata *ExperimentRunMetadata
-
-	for _, repetitions := range data {
-		node, metadata = findReferencePoint(repetitions)
-	}
-	if node == nil || metadata == nil {
-		return
-	}
-
-	msgCounts := make(map[string]map[string][]*MsgCountRow)
-	avgMsgCounts := make(map[string][]*MsgCountRow)
-
-	nodeSet := make(map[string]struct{})
-
 	for protocol, repetitions := range data {
-		msgCounts[protocol] = make(map[string][]*MsgCountRow)
-		avgMsgCounts[protocol] = []*MsgCountRow{}
+		nodeSent := map[string]map[int64]float64{}
+		nodeRcvd := map[string]map[int64]float64{}
+		nodeCount := map[string]map[int64]int64{}
+		repetitionSent := []map[int64]float64{}
+		repetitionRcvd := []map[int64]float64{}
+		repetitionSentRate := []map[int64]float64{}
+		repetitionRcvdRate := []map[int64]float64{}
 
 		for _, repetition := range repetitions {
-			for name := range repetition.Nodes {
-				nodeSet[name] = struct{}{}
-				if _, ok := msgCounts[protocol][name]; !ok {
-					msgCounts[protocol][name] = []*MsgCountRow{}
+			sent := map[string]map[int64]float64{}
+			rcvd := map[string]map[int64]float64{}
+			count := map[string]map[int64]int64{}
+			for nodeName, nodeData := range repetition.Nodes {
+				if _, ok := nodeSent[nodeName]; !ok {
+					nodeSent[nodeName] = map[int64]float64{}
+					nodeRcvd[nodeName] = map[int64]float64{}
+					nodeCount[nodeName] = map[int64]int64{}
 				}
-			}
-		}
-	}
-
-	for protocol, repetitions := range data {
-
-		totalSent := map[int64]int64{}
-		totalRcvd := map[int64]int64{}
-		totalCount := map[int64]int64{}
-
-		for nodeName := range nodeSet {
-
-			sumSent := map[int64]int64{}
-			sumRcvd := map[int64]int64{}
-			count := map[int64]int64{}
-
-			for _, repetition := range repetitions {
-				nodeData, ok := repetition.Nodes[nodeName]
-				if !ok {
-					continue
-				}
-
+				sent[nodeName] = map[int64]float64{}
+				rcvd[nodeName] = map[int64]float64{}
+				count[nodeName] = map[int64]int64{}
 				for _, row := range nodeData.MsgCounts {
-					event := findActiveEvent(row.Timestamp, metadata.Events)
+					event := findActiveEvent(row.Timestamp, repetition.Metadata.Events)
 					if event != nil && containsString(event.ExcludeNodes, nodeName) {
 						continue
 					}
-
-					sumSent[row.Timestamp] += row.Sent
-					sumRcvd[row.Timestamp] += row.Rcvd
-					count[row.Timestamp]++
-
-					totalSent[row.Timestamp] += row.Sent
-					totalRcvd[row.Timestamp] += row.Rcvd
-					totalCount[row.Timestamp]++
+					sent[nodeName][row.Timestamp] += row.Sent
+					rcvd[nodeName][row.Timestamp] += row.Rcvd
+					count[nodeName][row.Timestamp]++
+					nodeSent[nodeName][row.Timestamp] += row.Sent
+					nodeRcvd[nodeName][row.Timestamp] += row.Rcvd
+					nodeCount[nodeName][row.Timestamp]++
 				}
 			}
-
-			timestamps := mapKeysInt64(sumSent)
-			sort.Slice(timestamps, func(i, j int) bool {
-				return timestamps[i] < timestamps[j]
-			})
-
-			for _, ts := range timestamps {
-				msgCounts[protocol][nodeName] = append(
-					msgCounts[protocol][nodeName],
-					&MsgCountRow{
-						Timestamp: ts,
-						Sent:      sumSent[ts] / count[ts],
-						Rcvd:      sumRcvd[ts] / count[ts],
-					},
-				)
-			}
+			meanSent := meanOfNodes(sent, count)
+			meanRcvd := meanOfNodes(rcvd, count)
+			repetitionSent = append(repetitionSent, meanSent)
+			repetitionRcvd = append(repetitionRcvd, meanRcvd)
+			repetitionSentRate = append(repetitionSentRate, rateSeries(meanSent))
+			repetitionRcvdRate = append(repetitionRcvdRate, rateSeries(meanRcvd))
 		}
 
-		timestamps := mapKeysInt64(totalSent)
-		sort.Slice(timestamps, func(i, j int) bool {
-			return timestamps[i] < timestamps[j]
-		})
-
-		for _, ts := range timestamps {
-			avgMsgCounts[protocol] = append(
-				avgMsgCounts[protocol],
-				&MsgCountRow{
-					Timestamp: ts,
-					Sent:      totalSent[ts] / totalCount[ts],
-					Rcvd:      totalRcvd[ts] / totalCount[ts],
-				},
-			)
-		}
-	}
-
-	for protocol, nodes := range msgCounts {
 		parts := strings.Split(protocol, "_")
 		protocolName := parts[len(parts)-1]
 
-		writeMsgCountsToCSV(
+		writeSentRcvdStatsToCSV(
 			fmt.Sprintf("%s/%s_msgcount_averaged.csv", dirPath, protocolName),
-			avgMsgCounts[protocol],
+			aggregateRepetitions(repetitionSent),
+			aggregateRepetitions(repetitionRcvd),
+			0,
 		)
 
-		writeMsgRateToCSV(
+		writeSentRcvdStatsToCSV(
 			fmt.Sprintf("%s/%s_msgrate_averaged.csv", dirPath, protocolName),
-			avgMsgCounts[protocol],
+			aggregateRepetitions(repetitionSentRate),
+			aggregateRepetitions(repetitionRcvdRate),
+			2,
 		)
 
-		for nodeName, rows := range nodes {
+		for nodeName, sent := range nodeSent {
+			timestamps := mapKeysInt64(sent)
+			sort.Slice(timestamps, func(i, j int) bool {
+				return timestamps[i] < timestamps[j]
+			})
+
+			rows := []*MsgCountRow{}
+			for _, ts := range timestamps {
+				count := nodeCount[nodeName][ts]
+				rows = append(rows, &MsgCountRow{
+					Timestamp: ts,
+					Sent:      sent[ts] / float64(count),
+					Rcvd:      nodeRcvd[nodeName][ts] / float64(count),
+				})
+			}
+
 			writeMsgCountsToCSV(
 				fmt.Sprintf("%s/%s_msgcount_%s.csv", dirPath, protocolName, nodeName),
 				rows,
@@ -474,15 +543,6 @@ func findActiveEvent(timestamp int64, events []*EventMetadata) *EventMetadata {
 	return active
 }
 
-func findReferencePoint(experiment map[string]*RepetitionData) (*NodeData, *ExperimentRunMetadata) {
-	for _, repetition := range experiment {
-		for _, node := range repetition.Nodes {
-			return node, repetition.Metadata
-		}
-	}
-	return nil, nil
-}
-
 func writeValuesToCSV(filename string, data []*ValueRow) {
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
@@ -494,7 +554,7 @@ func writeValuesToCSV(filename string, data []*ValueRow) {
 	w := csv.NewWriter(file)
 
 	for _, point := range data {
-		tsStr := strconv.FormatInt(point.Timestamp, 10)
+		tsStr := formatTimestamp(point.Timestamp)
 		valStr := strconv.FormatFloat(point.Value, 'f', 2, 64)
 		err := w.Write([]string{tsStr, valStr})
 		if err != nil {
@@ -516,9 +576,9 @@ func writeMsgCountsToCSV(filename string, data []*MsgCountRow) {
 
 	for _, r := range data {
 		w.Write([]string{
-			strconv.FormatInt(r.Timestamp, 10),
-			strconv.FormatInt(r.Sent, 10),
-			strconv.FormatInt(r.Rcvd, 10),
+			formatTimestamp(r.Timestamp),
+			strconv.FormatFloat(r.Sent, 'f', -1, 64),
+			strconv.FormatFloat(r.Rcvd, 'f', -1, 64),
 		})
 	}
 	w.Flush()
@@ -544,11 +604,11 @@ func writeMsgRateToCSV(filename string, data []*MsgCountRow) {
 			continue
 		}
 
-		sentRate := float64(data[i].Sent-data[i-1].Sent) / float64(dt)
-		rcvdRate := float64(data[i].Rcvd-data[i-1].Rcvd) / float64(dt)
+		sentRate := (data[i].Sent - data[i-1].Sent) / seconds(dt)
+		rcvdRate := (data[i].Rcvd - data[i-1].Rcvd) / seconds(dt)
 
 		w.Write([]string{
-			strconv.FormatInt(data[i].Timestamp, 10),
+			formatTimestamp(data[i].Timestamp),
 			strconv.FormatFloat(sentRate, 'f', 2, 64),
 			strconv.FormatFloat(rcvdRate, 'f', 2, 64),
 		})
@@ -1,10 +1,24 @@
 package main
 
+import "encoding/json"
+
 type Graph struct {
 	Adj [][]int `json:"edges"`
 	Deg []int   `json:"degree"`
 }
 
+type GraphMetrics struct {
+	Nodes                 int                `json:"nodes"`
+	Edges                 int                `json:"edges"`
+	Diameter              int                `json:"diameter"`
+	AvgDegree             float64            `json:"avg_degree"`
+	DegreeDistribution    map[int]int        `json:"degree_distribution"`
+	ClusteringCoefficient float64            `json:"clustering_coefficient"`
+	LocalClustering       map[string]float64 `json:"local_clustering"`
+	Root                  string             `json:"root"`
+	HopDistance           map[string]int     `json:"hop_distance"`
+}
+
 type JobPlan struct {
 	OverlayGroup     string  `json:"overlay_group"`
 	Protocol         string  `json:"protocol"`
@@ -12,15 +26,26 @@ type JobPlan struct {
 	NodesCount       int     `json:"nodes_count"`
 	AvgDegree        int     `json:"avg_degree"`
 	LatencyMS        int     `json:"latency"`
+	LatencyModel     string  `json:"latency_model"`
+	LatencySeed      int64   `json:"latency_seed"`
 	LossPercentage   int     `json:"loss"`
 	Repetitions      int     `json:"repeat"`
 	ExpectedValue    float64 `json:"expected_value"`
+	InputModel       string  `json:"input_model"`
+	InputSeed        int64   `json:"input_seed"`
 	StabilizationS   int     `json:"stabilization_wait"`
 	EventWaitS       int     `json:"event_wait"`
 	EventName        string  `json:"event"`
 	AfterEventWaitMS int     `json:"end_wait"`
 	EnvFile          string  `json:"params"`
+	Topology         string  `json:"topology"`
+	Seed             int64   `json:"seed"`
+	TopologyFile     string  `json:"topology_file"`
+	TopologyHash     string  `json:"topology_hash"`
 	Graph            Graph   `json:"graph"`
+
+	SweepName   string                     `json:"sweep_name,omitempty"`
+	SweepParams map[string]json.RawMessage `json:"sweep_params,omitempty"`
 }
 
 type Job struct {
@@ -37,10 +62,31 @@ type ExperimentRunMetadata struct {
 	StopEventsTs      int64            `json:"events_stop_ts"`
 	StopExperimentTs  int64            `json:"exp_stop_ts"`
 	Events            []*EventMetadata `json:"events"`
+	InputValues       []float64        `json:"input_values"`
+	TimeToReadyMS     int64            `json:"time_to_ready_ms"`
+	Aborted           bool             `json:"aborted"`
 }
 
 type EventMetadata struct {
-	EventTs       int64    `json:"event_ts"`
+	Name          string              `json:"event"`
+	EventTs       int64               `json:"event_ts"`
+	ExpectedValue float64             `json:"expected_value"`
+	ExcludeNodes  []string            `json:"exclude_nodes"`
+	Partitions    []PartitionMetadata `json:"partitions"`
+}
+
+type PartitionMetadata struct {
+	Nodes         []string `json:"nodes"`
 	ExpectedValue float64  `json:"expected_value"`
-	ExcludeNodes  []string `json:"exclude_nodes"`
+}
+
+// ExpectedValueOf returns the ground truth a node is judged against, the one
+// of its own side while the network is partitioned.
+func (event *EventMetadata) ExpectedValueOf(nodeName string) float64 {
+	for _, partition := range event.Partitions {
+		if containsString(partition.Nodes, nodeName) {
+			return partition.ExpectedValue
+		}
+	}
+	return event.ExpectedValue
 }
@@ -75,7 +75,7 @@ func parseMsgCountRow(rec []string) (MsgCountRow, error) {
 
 	return MsgCountRow{
 		Timestamp: ts,
-		Sent:      sent,
-		Rcvd:      rcvd,
+		Sent:      float64(sent),
+		Rcvd:      float64(rcvd),
 	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tamararankovic/hidera_eval/configfile"
+)
+
+const DEFAULT_PROTOCOLS_FILE = configfile.DEFAULT_PROTOCOLS_FILE
+
+// ProtocolSpec is the part of an entry of the protocol registry of run that
+// analyze uses.
+type ProtocolSpec struct {
+	Code string `json:"code"`
+}
+
+// protocols are the codes of the registered protocols, in registry order,
+// protocolRegistryFile is the registry as read.
+var (
+	protocols            = []string{}
+	protocolRegistryFile []byte
+)
+
+func loadProtocolRegistry(path string) error {
+	path, err := configfile.Find(path, DEFAULT_PROTOCOLS_FILE)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("protocol registry %s not found", DEFAULT_PROTOCOLS_FILE)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	specs := []ProtocolSpec{}
+	if err := json.Unmarshal(content, &specs); err != nil {
+		return fmt.Errorf("protocol registry %s: %w", path, err)
+	}
+
+	protocols = []string{}
+	for _, spec := range specs {
+		if spec.Code == "" {
+			return fmt.Errorf("protocol registry %s: protocol without code", path)
+		}
+		protocols = append(protocols, spec.Code)
+	}
+	protocolRegistryFile = content
+	return nil
+}
+
+// writeProtocolRegistry copies the registry next to the analyzed series, plot
+// takes the protocols and their colors from there.
+func writeProtocolRegistry() {
+	err := os.WriteFile(fmt.Sprintf("%s/%s", dirPath, DEFAULT_PROTOCOLS_FILE), protocolRegistryFile, 0666)
+	if err != nil {
+		log.Println(err)
+	}
+}
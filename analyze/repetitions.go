@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// SeriesStats summarizes the series of all repetitions at a timestamp.
+type SeriesStats struct {
+	Timestamp int64
+	Stats
+}
+
+// meanOfNodes averages the outputs of every node at a timestamp first, and
+// then the nodes, so nodes that report more often don't weigh more.
+func meanOfNodes(sum map[string]map[int64]float64, count map[string]map[int64]int64) map[int64]float64 {
+	nodesSum := map[int64]float64{}
+	nodes := map[int64]int64{}
+	for nodeName, nodeSum := range sum {
+		for ts, value := range nodeSum {
+			nodesSum[ts] += value / float64(count[nodeName][ts])
+			nodes[ts]++
+		}
+	}
+	mean := map[int64]float64{}
+	for ts, value := range nodesSum {
+		mean[ts] = value / float64(nodes[ts])
+	}
+	return mean
+}
+
+// rateSeries returns the per second change of a cumulative series.
+func rateSeries(series map[int64]float64) map[int64]float64 {
+	timestamps := mapKeysInt64(series)
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	rate := map[int64]float64{}
+	for i := 1; i < len(timestamps); i++ {
+		dt := timestamps[i] - timestamps[i-1]
+		rate[timestamps[i]] = (series[timestamps[i]] - series[timestamps[i-1]]) / seconds(dt)
+	}
+	return rate
+}
+
+// aggregateRepetitions returns the mean, standard deviation and 95%
+// confidence interval across the repetitions that have a value at each
+// timestamp.
+func aggregateRepetitions(series []map[int64]float64) []SeriesStats {
+	values := map[int64][]float64{}
+	for _, repetition := range series {
+		for ts, value := range repetition {
+			values[ts] = append(values[ts], value)
+		}
+	}
+
+	timestamps := mapKeysInt64(values)
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	points := []SeriesStats{}
+	for _, ts := range timestamps {
+		points = append(points, SeriesStats{Timestamp: ts, Stats: newStats(values[ts])})
+	}
+	return points
+}
+
+// writeSeriesStatsToCSV writes timestamp, mean, standard deviation, lower
+// and upper bound of the 95% confidence interval and number of repetitions.
+func writeSeriesStatsToCSV(filename string, points []SeriesStats) {
+	rows := [][]string{}
+	for _, point := range points {
+		rows = append(rows, append(
+			[]string{formatTimestamp(point.Timestamp)},
+			append(formatStats(point.Stats, 2), strconv.Itoa(point.N))...,
+		))
+	}
+	writeRowsToCSV(filename, rows)
+}
+
+// writeSentRcvdStatsToCSV writes timestamp, mean sent and received followed
+// by the standard deviation and 95% confidence interval of sent, those of
+// received and the number of repetitions. Counts are written with precision
+// 0 and rounded.
+func writeSentRcvdStatsToCSV(filename string, sent, rcvd []SeriesStats, precision int) {
+	rcvdAt := map[int64]Stats{}
+	for _, point := range rcvd {
+		rcvdAt[point.Timestamp] = point.Stats
+	}
+
+	rows := [][]string{}
+	for _, point := range sent {
+		rcvdStats := rcvdAt[point.Timestamp]
+		sentFields := formatStats(point.Stats, precision)
+		rcvdFields := formatStats(rcvdStats, precision)
+		row := []string{formatTimestamp(point.Timestamp), sentFields[0], rcvdFields[0]}
+		row = append(row, sentFields[1:]...)
+		row = append(row, rcvdFields[1:]...)
+		row = append(row, strconv.Itoa(point.N))
+		rows = append(rows, row)
+	}
+	writeRowsToCSV(filename, rows)
+}
+
+// formatStats formats mean, standard deviation and the bounds of the 95%
+// confidence interval.
+func formatStats(stats Stats, precision int) []string {
+	fields := []string{}
+	for _, value := range []float64{stats.Mean, stats.StdDev, stats.CI95Low, stats.CI95Hi} {
+		if precision == 0 {
+			value = math.Round(value)
+		}
+		fields = append(fields, strconv.FormatFloat(value, 'f', precision, 64))
+	}
+	return fields
+}
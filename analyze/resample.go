@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_RESAMPLE_RESOLUTION = "1s"
+	RESAMPLE_STEP               = "step"
+	RESAMPLE_LINEAR             = "linear"
+)
+
+// Timestamps are in milliseconds once preprocessed.
+const MILLIS_PER_SECOND = 1000
+
+func seconds(ts int64) float64 {
+	return float64(ts) / MILLIS_PER_SECOND
+}
+
+func formatTimestamp(ts int64) string {
+	return strconv.FormatFloat(seconds(ts), 'f', 3, 64)
+}
+
+// resample puts the value and message count series of every node on a
+// common grid of the given resolution, so that the outputs of different
+// nodes and repetitions are compared at the same instants. Between two
+// samples the grid takes the earlier sample (step) or interpolates between
+// them (linear). The grid never reaches beyond the first and last sample of
+// a node.
+func resample(data map[string]map[string]*RepetitionData, resolution int64, method string) {
+	for _, repetitions := range data {
+		for _, repetition := range repetitions {
+			for _, node := range repetition.Nodes {
+				node.Values = resampleValues(node.Values, resolution, method)
+				node.MsgCounts = resampleMsgCounts(node.MsgCounts, resolution, method)
+			}
+		}
+	}
+}
+
+// gridPoints calls add for every grid point between the first and the last
+// of the sorted timestamps, with the indexes of the samples before and after
+// it and the weight of the later one.
+func gridPoints(timestamps []int64, resolution int64, add func(ts int64, before, after int, weight float64)) {
+	if len(timestamps) == 0 {
+		return
+	}
+	first := timestamps[0]
+	last := timestamps[len(timestamps)-1]
+	ts := first - first%resolution
+	if ts < first {
+		ts += resolution
+	}
+	i := 0
+	for ; ts <= last; ts += resolution {
+		for i+1 < len(timestamps) && timestamps[i+1] <= ts {
+			i++
+		}
+		if timestamps[i] == ts || i+1 == len(timestamps) {
+			add(ts, i, i, 0)
+			continue
+		}
+		weight := float64(ts-timestamps[i]) / float64(timestamps[i+1]-timestamps[i])
+		add(ts, i, i+1, weight)
+	}
+}
+
+func resampleValues(rows []*ValueRow, resolution int64, method string) []*ValueRow {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Timestamp < rows[j].Timestamp
+	})
+	timestamps := make([]int64, len(rows))
+	for i, row := range rows {
+		timestamps[i] = row.Timestamp
+	}
+
+	resampled := []*ValueRow{}
+	gridPoints(timestamps, resolution, func(ts int64, before, after int, weight float64) {
+		value := rows[before].Value
+		if method == RESAMPLE_LINEAR {
+			value += weight * (rows[after].Value - rows[before].Value)
+		}
+		resampled = append(resampled, &ValueRow{Timestamp: ts, Value: value})
+	})
+	return resampled
+}
+
+func resampleMsgCounts(rows []*MsgCountRow, resolution int64, method string) []*MsgCountRow {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Timestamp < rows[j].Timestamp
+	})
+	timestamps := make([]int64, len(rows))
+	for i, row := range rows {
+		timestamps[i] = row.Timestamp
+	}
+
+	resampled := []*MsgCountRow{}
+	gridPoints(timestamps, resolution, func(ts int64, before, after int, weight float64) {
+		row := &MsgCountRow{Timestamp: ts, Sent: rows[before].Sent, Rcvd: rows[before].Rcvd}
+		if method == RESAMPLE_LINEAR {
+			row.Sent += weight * (rows[after].Sent - rows[before].Sent)
+			row.Rcvd += weight * (rows[after].Rcvd - rows[before].Rcvd)
+		}
+		resampled = append(resampled, row)
+	})
+	return resampled
+}
+
+// parseResampling checks the resampling settings and returns the resolution
+// in milliseconds.
+func parseResampling(resolution, method string) (int64, error) {
+	duration, err := time.ParseDuration(resolution)
+	if err != nil {
+		return 0, fmt.Errorf("resample resolution: %w", err)
+	}
+	if duration < time.Millisecond {
+		return 0, fmt.Errorf("resample resolution %s is shorter than a millisecond", resolution)
+	}
+	if method != RESAMPLE_STEP && method != RESAMPLE_LINEAR {
+		return 0, fmt.Errorf("resample method %q is neither %s nor %s", method, RESAMPLE_STEP, RESAMPLE_LINEAR)
+	}
+	return duration.Milliseconds(), nil
+}
+
+// writeResampling records the grid all analyzed series are on.
+func writeResampling(resolution int64, method string) {
+	resamplingJson, err := json.Marshal(map[string]interface{}{
+		"resolution_ms": resolution,
+		"method":        method,
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = os.WriteFile(fmt.Sprintf("%s/resampling.json", dirPath), resamplingJson, 0666)
+	if err != nil {
+		log.Println(err)
+	}
+}
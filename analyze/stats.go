@@ -0,0 +1,80 @@
+package main
+
+import "math"
+
+// tCritical95 holds the two-sided 95% critical values of Student's t
+// distribution for 1 to 30 degrees of freedom.
+var tCritical95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// meanStdDev returns the mean and the sample standard deviation of values.
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	squares := 0.0
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)-1))
+}
+
+// confidenceInterval95 returns the mean of values and the half width of its
+// 95% confidence interval, which is 0 for fewer than two values.
+func confidenceInterval95(values []float64) (float64, float64) {
+	mean, stdDev := meanStdDev(values)
+	if len(values) < 2 {
+		return mean, 0
+	}
+	t := 1.960
+	if df := len(values) - 1; df <= len(tCritical95) {
+		t = tCritical95[df-1]
+	}
+	return mean, t * stdDev / math.Sqrt(float64(len(values)))
+}
+
+// percentile returns the p-th percentile of the sorted values, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// Stats summarizes a metric across repetitions.
+type Stats struct {
+	N       int     `json:"n"`
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stddev"`
+	CI95Low float64 `json:"ci95_low"`
+	CI95Hi  float64 `json:"ci95_high"`
+}
+
+func newStats(values []float64) Stats {
+	mean, stdDev := meanStdDev(values)
+	_, halfWidth := confidenceInterval95(values)
+	return Stats{
+		N:       len(values),
+		Mean:    mean,
+		StdDev:  stdDev,
+		CI95Low: mean - halfWidth,
+		CI95Hi:  mean + halfWidth,
+	}
+}
@@ -0,0 +1,52 @@
+// Package configfile finds the hidera.yaml config and the protocol registry,
+// the files run and analyze share.
+package configfile
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	DEFAULT_CONFIG_FILE    = "hidera.yaml"
+	DEFAULT_PROTOCOLS_FILE = "protocols.json"
+	ENV_PREFIX             = "HIDERA_"
+)
+
+// Find returns path if it is set, and otherwise the first of name and
+// ../name that exists, or "" if neither does.
+func Find(path, name string) (string, error) {
+	if path != "" {
+		_, err := os.Stat(path)
+		return path, err
+	}
+	for _, candidate := range []string{name, "../" + name} {
+		_, err := os.Stat(candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Read reads the config file at path, or the one HIDERA_CONFIG names if path
+// is empty, or else hidera.yaml from its default locations. It returns the
+// path it read along with the content, a missing default config file is no
+// error and gives no content.
+func Read(path string) ([]byte, string, error) {
+	if path == "" {
+		path = os.Getenv(ENV_PREFIX + "CONFIG")
+	}
+	path, err := Find(path, DEFAULT_CONFIG_FILE)
+	if err != nil || path == "" {
+		return nil, "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, path, nil
+}
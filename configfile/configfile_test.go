@@ -0,0 +1,50 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "run")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv(ENV_PREFIX+"CONFIG", "")
+
+	if content, path, err := Read(""); err != nil || content != nil || path != "" {
+		t.Errorf("Read without a config = %q, %q, %v", content, path, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(parent, DEFAULT_CONFIG_FILE), []byte("walltime: 1h\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if content, path, err := Read(""); err != nil || string(content) != "walltime: 1h\n" || path != "../"+DEFAULT_CONFIG_FILE {
+		t.Errorf("Read of the parent config = %q, %q, %v", content, path, err)
+	}
+
+	if err := os.WriteFile(DEFAULT_CONFIG_FILE, []byte("walltime: 2h\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if content, path, err := Read(""); err != nil || string(content) != "walltime: 2h\n" || path != DEFAULT_CONFIG_FILE {
+		t.Errorf("Read of the config in the working directory = %q, %q, %v", content, path, err)
+	}
+
+	t.Setenv(ENV_PREFIX+"CONFIG", "missing.yaml")
+	if _, _, err := Read(""); err == nil {
+		t.Error("missing config named by HIDERA_CONFIG accepted")
+	}
+	if content, _, err := Read("../" + DEFAULT_CONFIG_FILE); err != nil || string(content) != "walltime: 1h\n" {
+		t.Errorf("Read of a given path = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/tamararankovic/hidera_eval/configfile
+
+go 1.19
@@ -1,57 +1,81 @@
 import csv
+import json
 import os
 import sys
 import matplotlib.pyplot as plt
 
-# --------------------------------------------------
-# Config
-# --------------------------------------------------
-
-BASE_DIR = "/home/tamara/experiments"
-# BASE_DIR = "/Users/tamararankovic/Documents/monitoring/impl/hidera_eval/tmp"
-
-PROTOCOLS = ["hi", "fu", "ep", "dd", "rr"]
-COLORS = {
-    "hi": "tab:blue",
-    "fu": "tab:orange",
-    "ep": "tab:green",
-    "dd": "tab:red",
-    "rr": "tab:purple",
-}
-
 # --------------------------------------------------
 # Args
 # --------------------------------------------------
 
 if len(sys.argv) < 2:
-    print("Usage: python plot_results.py <experiment-name>")
+    print("Usage: python plot_results.py <experiment-name> [<experiments-dir>]")
     sys.exit(1)
 
 EXPERIMENT = sys.argv[1]
+if len(sys.argv) > 2:
+    BASE_DIR = sys.argv[2]
+else:
+    BASE_DIR = os.environ.get("HIDERA_EXPERIMENTS_DIR") or "../experiments"
 
 ANALYZED_DIR = os.path.join(BASE_DIR, f"{EXPERIMENT}_analyzed")
 PLOTS_DIR = os.path.join(BASE_DIR, f"{EXPERIMENT}_plots")
 
 os.makedirs(PLOTS_DIR, exist_ok=True)
 
+# --------------------------------------------------
+# Protocols
+# --------------------------------------------------
+
+def load_protocols():
+    """Codes and colors of the protocol registry analyze copied next to the
+    analyzed series."""
+    path = os.path.join(ANALYZED_DIR, "protocols.json")
+    if not os.path.exists(path):
+        print(f"Protocol registry {path} not found, run analyze first")
+        sys.exit(1)
+    with open(path) as f:
+        specs = json.load(f)
+    return [spec["code"] for spec in specs], {spec["code"]: spec["color"] for spec in specs}
+
+
+PROTOCOLS, COLORS = load_protocols()
+
 # --------------------------------------------------
 # CSV readers
 # --------------------------------------------------
 
+def read_optional_float(cell):
+    """Relative errors are left empty where the ground truth is 0."""
+    return float(cell) if cell != "" else float("nan")
+
+
 def read_value_csv(path):
     ts, vals = [], []
     with open(path) as f:
         for row in csv.reader(f):
-            ts.append(int(row[0]))
+            ts.append(float(row[0]))
             vals.append(float(row[1]))
     return ts, vals
 
 
+def read_value_stats_csv(path):
+    """Averaged series: timestamp, mean, stddev, 95% CI low, 95% CI high, n."""
+    ts, vals, ci_low, ci_high = [], [], [], []
+    with open(path) as f:
+        for row in csv.reader(f):
+            ts.append(float(row[0]))
+            vals.append(float(row[1]))
+            ci_low.append(float(row[3]))
+            ci_high.append(float(row[4]))
+    return ts, vals, ci_low, ci_high
+
+
 def read_msgcount_csv(path):
     ts, sent, rcvd = [], [], []
     with open(path) as f:
         for row in csv.reader(f):
-            ts.append(int(row[0]))
+            ts.append(float(row[0]))
             sent.append(int(row[1]))
             rcvd.append(int(row[2]))
     return ts, sent, rcvd
@@ -61,7 +85,7 @@ def read_msgrate_csv(path):
     ts, sent, rcvd = [], [], []
     with open(path) as f:
         for row in csv.reader(f):
-            ts.append(int(row[0]))
+            ts.append(float(row[0]))
             sent.append(float(row[1]))
             rcvd.append(float(row[2]))
     return ts, sent, rcvd
@@ -85,12 +109,13 @@ for proto in PROTOCOLS:
     path = os.path.join(ANALYZED_DIR, f"{proto}_value_averaged.csv")
     if not os.path.exists(path):
         continue
-    ts, vals = read_value_csv(path)
+    ts, vals, ci_low, ci_high = read_value_stats_csv(path)
     plt.plot(ts, vals, color=COLORS[proto], label=proto)
+    plt.fill_between(ts, ci_low, ci_high, color=COLORS[proto], alpha=0.2)
 
 plt.xlabel("time [s]")
 plt.ylabel("value")
-plt.title("Expected vs Real Value")
+plt.title("Expected vs Real Value (95% CI across repetitions)")
 plt.legend()
 plt.grid(True)
 plt.tight_layout()
@@ -150,19 +175,17 @@ plt.close()
 plt.figure(figsize=(10, 5))
 
 for proto in PROTOCOLS:
-    path = os.path.join(ANALYZED_DIR, f"{proto}_value_averaged.csv")
+    path = os.path.join(ANALYZED_DIR, f"{proto}_error.csv")
     if not os.path.exists(path):
         continue
 
-    ts, vals = read_value_csv(path)
-    mae_ts, mae_vals = [], []
-
-    for t, v in zip(ts, vals):
-        if t in expected_map:
-            mae_ts.append(t)
-            mae_vals.append(abs(v - expected_map[t]))
+    ts, mae_vals = [], []
+    with open(path) as f:
+        for row in csv.reader(f):
+            ts.append(float(row[0]))
+            mae_vals.append(float(row[1]))
 
-    plt.plot(mae_ts, mae_vals, color=COLORS[proto], label=proto)
+    plt.plot(ts, mae_vals, color=COLORS[proto], label=proto)
 
 plt.xlabel("time [s]")
 plt.ylabel("MAE")
@@ -173,6 +196,97 @@ plt.tight_layout()
 plt.savefig(os.path.join(PLOTS_DIR, "mae.png"))
 plt.close()
 
+# --------------------------------------------------
+# 4b. Mean Relative Error
+# --------------------------------------------------
+
+plt.figure(figsize=(10, 5))
+
+for proto in PROTOCOLS:
+    path = os.path.join(ANALYZED_DIR, f"{proto}_error.csv")
+    if not os.path.exists(path):
+        continue
+
+    ts, mre_vals = [], []
+    with open(path) as f:
+        for row in csv.reader(f):
+            ts.append(float(row[0]))
+            mre_vals.append(read_optional_float(row[2]))
+
+    plt.plot(ts, mre_vals, color=COLORS[proto], label=proto)
+
+plt.xlabel("time [s]")
+plt.ylabel("MRE")
+plt.title("Mean Relative Error")
+plt.legend()
+plt.grid(True)
+plt.tight_layout()
+plt.savefig(os.path.join(PLOTS_DIR, "mre.png"))
+plt.close()
+
+# --------------------------------------------------
+# 4c. Relative error distribution across nodes
+# --------------------------------------------------
+
+plt.figure(figsize=(10, 5))
+
+for proto in PROTOCOLS:
+    path = os.path.join(ANALYZED_DIR, f"{proto}_error_stats.csv")
+    if not os.path.exists(path):
+        continue
+
+    ts, p50, p90, max_rel = [], [], [], []
+    with open(path) as f:
+        for row in csv.reader(f):
+            ts.append(float(row[0]))
+            p50.append(read_optional_float(row[7]))
+            p90.append(read_optional_float(row[8]))
+            max_rel.append(read_optional_float(row[10]))
+
+    plt.plot(ts, p50, color=COLORS[proto], label=f"{proto} p50")
+    plt.fill_between(ts, p50, p90, color=COLORS[proto], alpha=0.2)
+    plt.plot(ts, max_rel, color=COLORS[proto], linestyle=":", label=f"{proto} max")
+
+plt.xlabel("time [s]")
+plt.ylabel("relative error")
+plt.title("Relative Error Across Nodes (p50, p50-p90 band, max)")
+plt.legend(ncol=2)
+plt.grid(True)
+plt.tight_layout()
+plt.savefig(os.path.join(PLOTS_DIR, "error_percentiles.png"))
+plt.close()
+
+# --------------------------------------------------
+# 4d. Relative error CDF
+# --------------------------------------------------
+
+plt.figure(figsize=(10, 5))
+
+for proto in PROTOCOLS:
+    path = os.path.join(ANALYZED_DIR, f"{proto}_error_cdf.csv")
+    if not os.path.exists(path):
+        continue
+
+    fractions, rel = [], []
+    with open(path) as f:
+        for row in csv.reader(f):
+            if row[2] == "":
+                continue
+            fractions.append(float(row[0]))
+            rel.append(float(row[2]))
+
+    plt.plot(rel, fractions, color=COLORS[proto], label=proto)
+
+plt.xscale("symlog", linthresh=1e-3)
+plt.xlabel("relative error")
+plt.ylabel("fraction of node outputs")
+plt.title("Relative Error CDF")
+plt.legend()
+plt.grid(True)
+plt.tight_layout()
+plt.savefig(os.path.join(PLOTS_DIR, "error_cdf.png"))
+plt.close()
+
 # --------------------------------------------------
 # 5. Scatter plot: real vs expected
 # --------------------------------------------------
@@ -196,7 +310,7 @@ for proto in PROTOCOLS:
         # Match per-node files: <proto>_value_<node>.csv
         if not fname.startswith(f"{proto}_value_"):
             continue
-        if fname.endswith("_averaged.csv"):
+        if fname.endswith("_averaged.csv") or fname.endswith("_value_expected.csv"):
             continue
 
         path = os.path.join(ANALYZED_DIR, fname)
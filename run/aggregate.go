@@ -0,0 +1,66 @@
+package main
+
+import "slices"
+
+const (
+	AGGREGATE_AVG   = "avg"
+	AGGREGATE_SUM   = "sum"
+	AGGREGATE_COUNT = "count"
+	AGGREGATE_MIN   = "min"
+	AGGREGATE_MAX   = "max"
+)
+
+var aggregateFns = map[string]func(values []float64) float64{
+	AGGREGATE_AVG:   AvgAggregate,
+	AGGREGATE_SUM:   SumAggregate,
+	AGGREGATE_COUNT: CountAggregate,
+	AGGREGATE_MIN:   MinAggregate,
+	AGGREGATE_MAX:   MaxAggregate,
+}
+
+func isAggregateValid(aggregate string) bool {
+	_, ok := aggregateFns[aggregate]
+	return ok || aggregate == ""
+}
+
+// aggregateFn returns the function the plan's protocols compute, the
+// average if the plan doesn't name one.
+func (jp JobPlan) aggregateFn() func(values []float64) float64 {
+	if fn, ok := aggregateFns[jp.Aggregate]; ok {
+		return fn
+	}
+	return AvgAggregate
+}
+
+func AvgAggregate(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return SumAggregate(values) / float64(len(values))
+}
+
+func SumAggregate(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum
+}
+
+func CountAggregate(values []float64) float64 {
+	return float64(len(values))
+}
+
+func MinAggregate(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return slices.Min(values)
+}
+
+func MaxAggregate(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return slices.Max(values)
+}
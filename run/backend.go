@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const (
+	BACKEND_CLUSTER = "cluster"
+	BACKEND_LOCAL   = "local"
+)
+
+// Backend abstracts where jobs are reserved and where their containers run.
+type Backend interface {
+	Submit(plan JobPlan) (*Job, error)
+	Reattach(plan JobPlan, ID int, host string) (*Job, error)
+	WaitRunning(ctx context.Context, jobs []*Job) error
+	SetUpNetwork(job Job) error
+	IPs(job Job) []string
+	ContainerPrefix(job Job) string
+	ContainerNetworkArgs(job Job, nodeID int) string
+	Partition(job Job, partitions [][]int) error
+	RunScript(host, script string, stdout, stderr io.Writer) error
+	WriteFile(host, path string, content []byte) error
+	Export(job Job) error
+	Terminate(jobs []*Job) error
+	ExperimentsDir() string
+	SourcesDir() string
+	ToolsDir() string
+}
+
+var backend Backend
+
+func newBackend(name, schedulerName, cluster string) (Backend, error) {
+	switch name {
+	case BACKEND_CLUSTER:
+		if cluster == "" {
+			return nil, fmt.Errorf("backend %s requires a cluster", name)
+		}
+		if config.ExperimentsDir == "" || config.SourcesDir == "" || config.ToolsDir == "" {
+			return nil, fmt.Errorf("backend %s requires experiments_dir, sources_dir and tools_dir on the cluster, set them in %s", name, DEFAULT_CONFIG_FILE)
+		}
+		var remote Remote = dryRun
+		if dryRun == nil {
+			sshRemote, err := newSSHRemote(config.Frontend)
+			if err != nil {
+				return nil, err
+			}
+			remote = sshRemote
+		}
+		walltime, err := config.WalltimeDuration()
+		if err != nil {
+			return nil, err
+		}
+		scheduler, err := newScheduler(schedulerName, remoteCmdRunner(remote), walltime)
+		if err != nil {
+			return nil, err
+		}
+		// oar-p2p finds the node of a job through OAR, nodes of other
+		// schedulers get network holder containers
+		var network Network = &oarP2PNetwork{}
+		if schedulerName != SCHEDULER_OAR {
+			network = &holderNetwork{run: remote.Run}
+		}
+		return newClusterBackend(scheduler, network, remote, cluster, config.ExperimentsDir, config.SourcesDir, config.ToolsDir), nil
+	case BACKEND_LOCAL:
+		return newLocalBackend(config.ExperimentsDir, config.SourcesDir, config.ToolsDir)
+	}
+	return nil, fmt.Errorf("unknown backend %s", name)
+}
+
+type clusterBackend struct {
+	scheduler      Scheduler
+	network        Network
+	pollIntervalS  int
+	remote         Remote
+	cluster        string
+	experimentsDir string
+	sourcesDir     string
+	toolsDir       string
+}
+
+func newClusterBackend(scheduler Scheduler, network Network, remote Remote, cluster, experimentsDir, sourcesDir, toolsDir string) *clusterBackend {
+	return &clusterBackend{
+		scheduler:      scheduler,
+		network:        network,
+		pollIntervalS:  5,
+		remote:         remote,
+		cluster:        cluster,
+		experimentsDir: experimentsDir,
+		sourcesDir:     sourcesDir,
+		toolsDir:       toolsDir,
+	}
+}
+
+// Submit reserves a node for the job. Its host is only known once the job
+// runs, WaitRunning fills it in.
+func (b *clusterBackend) Submit(plan JobPlan) (*Job, error) {
+	jobID, err := b.scheduler.Submit(plan.FullName(), b.cluster)
+	if err != nil {
+		return &Job{}, err
+	}
+	return &Job{JobPlan: plan, ID: jobID}, nil
+}
+
+// Reattach takes over a job of an earlier run that is still running or
+// waiting to run.
+func (b *clusterBackend) Reattach(plan JobPlan, ID int, host string) (*Job, error) {
+	states, err := b.scheduler.States([]int{ID})
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[ID]
+	if !ok {
+		return nil, fmt.Errorf("job %d not found", ID)
+	}
+	if state != JOB_STATE_RUNNING && !slices.Contains(JOB_STATES_WAITING, state) {
+		return nil, fmt.Errorf("job %d is in state %s", ID, state)
+	}
+	return &Job{JobPlan: plan, ID: ID, Host: host}, nil
+}
+
+// WaitRunning waits for all jobs to run and resolves the hosts of the jobs
+// that don't have one yet.
+func (b *clusterBackend) WaitRunning(ctx context.Context, jobs []*Job) error {
+	if err := waitJobsState(ctx, b.scheduler, jobs, JOB_STATE_RUNNING, b.pollIntervalS, 12); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Host != "" {
+			continue
+		}
+		host, err := b.scheduler.Host(job.ID)
+		if err != nil {
+			return fmt.Errorf("host of job %s (%d): %w", job.FullName(), job.ID, err)
+		}
+		job.Host = host
+	}
+	return nil
+}
+
+func (b *clusterBackend) SetUpNetwork(job Job) error {
+	return b.network.SetUp(job)
+}
+
+func (b *clusterBackend) IPs(job Job) []string {
+	return b.network.IPs(job)
+}
+
+func (b *clusterBackend) ContainerPrefix(job Job) string {
+	return b.network.ContainerPrefix(job)
+}
+
+func (b *clusterBackend) ContainerNetworkArgs(job Job, nodeID int) string {
+	return b.network.ContainerNetworkArgs(job, nodeID)
+}
+
+func (b *clusterBackend) Partition(job Job, partitions [][]int) error {
+	return b.network.Partition(job, partitions)
+}
+
+func (b *clusterBackend) RunScript(host, script string, stdout, stderr io.Writer) error {
+	return b.remote.Run(host, script, stdout, stderr)
+}
+
+func (b *clusterBackend) WriteFile(host, path string, content []byte) error {
+	return b.remote.Upload(host, path, content)
+}
+
+func (b *clusterBackend) Export(job Job) error {
+	return b.remote.Download(
+		config.Frontend,
+		fmt.Sprintf("%s/%s_plots", b.experimentsDir, job.ExperimanetName),
+		"../export/",
+	)
+}
+
+func (b *clusterBackend) Terminate(jobs []*Job) error {
+	return terminateAllJobs(b.scheduler, b.network, jobs)
+}
+
+func (b *clusterBackend) ExperimentsDir() string {
+	return b.experimentsDir
+}
+
+func (b *clusterBackend) SourcesDir() string {
+	return b.sourcesDir
+}
+
+func (b *clusterBackend) ToolsDir() string {
+	return b.toolsDir
+}
+
+func containerName(job Job, nodeID int) string {
+	return fmt.Sprintf("%snode_%d", backend.ContainerPrefix(job), nodeID)
+}
+
+func runHostScript(host, script string) error {
+	return backend.RunScript(host, script, os.Stdout, os.Stderr)
+}
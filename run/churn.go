@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func RestartNodesEvent(ctx context.Context, job Job, state *RunState) []EventMetadata {
+	events := []EventMetadata{}
+
+	dead := state.Dead()
+	nodeIDs := dead
+	if nodesStr := job.EventParams["nodes"]; nodesStr != "" {
+		nodeIDs = []int{}
+		for _, idStr := range strings.Split(nodesStr, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(idStr))
+			if err != nil {
+				log.Println(err)
+				return events
+			}
+			if slices.Contains(dead, id) {
+				nodeIDs = append(nodeIDs, id)
+			}
+		}
+	}
+	if len(nodeIDs) == 0 {
+		return events
+	}
+
+	if err := restartNodes(job, state, nodeIDs); err != nil {
+		log.Println(err)
+		return events
+	}
+
+	events = append(events, state.snapshot(now().UnixNano()))
+	return events
+}
+
+func JoinNodesEvent(ctx context.Context, job Job, state *RunState) []EventMetadata {
+	events := []EventMetadata{}
+
+	count, err := intEventParam(job, "count", 1)
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+	degree, err := intEventParam(job, "degree", job.AvgDegree)
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+
+	joined := 0
+	for range count {
+		ok, err := joinNode(job, state, degree)
+		if err != nil {
+			log.Println(err)
+			break
+		}
+		if !ok {
+			log.Printf("no spare addresses left in experiment %s, raise max_joins", job.FullName())
+			break
+		}
+		joined++
+	}
+	if joined == 0 {
+		return events
+	}
+
+	events = append(events, state.snapshot(now().UnixNano()))
+	return events
+}
+
+// ChurnEvent keeps changing the membership for the given duration. Changes
+// arrive as a Poisson process, each one is a join with join_probability and
+// a leave otherwise. A join starts a new node while spare addresses are left
+// and restarts a killed node afterwards. Node 1 and the root never leave.
+func ChurnEvent(ctx context.Context, job Job, state *RunState) []EventMetadata {
+	events := []EventMetadata{}
+
+	rate, err := floatEventParam(job, "rate", 0)
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+	if rate <= 0 {
+		log.Printf("churn rate must be positive, got %v", rate)
+		return events
+	}
+	duration, err := floatEventParam(job, "duration", float64(job.AfterEventWaitS))
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+	joinProbability, err := floatEventParam(job, "join_probability", 0.5)
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+	degree, err := intEventParam(job, "degree", job.AvgDegree)
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+
+	rng := rand.New(rand.NewSource(job.Seed + int64(state.Repetition)))
+	end := now().Add(time.Duration(duration * float64(time.Second)))
+	for {
+		wait := time.Duration(rng.ExpFloat64() / rate * float64(time.Second))
+		if now().Add(wait).After(end) {
+			break
+		}
+		if !sleepCtx(ctx, wait) {
+			break
+		}
+
+		var err error
+		if rng.Float64() < joinProbability {
+			err = churnJoin(job, state, degree, rng)
+		} else {
+			err = churnLeave(job, state, rng)
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		events = append(events, state.snapshot(now().UnixNano()))
+	}
+
+	return events
+}
+
+func churnJoin(job Job, state *RunState, degree int, rng *rand.Rand) error {
+	ok, err := joinNode(job, state, degree)
+	if err != nil || ok {
+		return err
+	}
+	dead := state.Dead()
+	if len(dead) == 0 {
+		return fmt.Errorf("churn in experiment %s: no node left to join", job.FullName())
+	}
+	return restartNodes(job, state, []int{dead[rng.Intn(len(dead))]})
+}
+
+func churnLeave(job Job, state *RunState, rng *rand.Rand) error {
+	candidates := []int{}
+	for _, id := range state.Alive() {
+		if id == 1 || id == job.NodesCount {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("churn in experiment %s: no node left to kill", job.FullName())
+	}
+	nodeID := candidates[rng.Intn(len(candidates))]
+
+	script := fmt.Sprintf("set -e\n\ndocker kill %s\n", containerName(job, nodeID))
+	if err := runHostScript(job.Host, script); err != nil {
+		return fmt.Errorf("failed to kill containers in experiment %s: %w", job.FullName(), err)
+	}
+
+	state.Kill([]int{nodeID})
+	return nil
+}
+
+func restartNodes(job Job, state *RunState, nodeIDs []int) error {
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString("set -e\n\n")
+
+	for _, nodeID := range nodeIDs {
+		scriptBuilder.WriteString(fmt.Sprintf("docker start %s\n", containerName(job, nodeID)))
+	}
+
+	if err := runHostScript(job.Host, scriptBuilder.String()); err != nil {
+		return fmt.Errorf("failed to restart containers in experiment %s: %w", job.FullName(), err)
+	}
+	if err := postInitialInputValues(job, state, nodeIDs); err != nil {
+		return err
+	}
+
+	state.Revive(nodeIDs)
+	return nil
+}
+
+// joinNode starts a fresh container on the next spare address, peered with
+// random live nodes. It returns false if no spare address is left.
+func joinNode(job Job, state *RunState, degree int) (bool, error) {
+	nodeID, peers, ok := state.ReserveJoin(degree)
+	if !ok {
+		return false, nil
+	}
+
+	peerIdxs := []int{}
+	for _, peer := range peers {
+		peerIdxs = append(peerIdxs, peer-1)
+	}
+
+	script := "set -e\n\n" + containerRunScript(job, nodeID, backend.IPs(job), peerIdxs, state.Repetition)
+	if err := runHostScript(job.Host, script); err != nil {
+		return false, fmt.Errorf("failed to join %s to experiment %s: %w", nodeName(nodeID), job.FullName(), err)
+	}
+	if err := postInitialInputValues(job, state, []int{nodeID}); err != nil {
+		return false, err
+	}
+
+	state.Join(nodeID, peers)
+	return true, nil
+}
+
+// postInitialInputValues hands restarted and joined nodes their initial
+// input value when the plan declares an input model.
+func postInitialInputValues(job Job, state *RunState, nodeIDs []int) error {
+	if job.InputModel == "" {
+		return nil
+	}
+	values := map[int]float64{}
+	for _, id := range nodeIDs {
+		values[id] = state.Initial(id)
+	}
+	return postInputValues(job, values)
+}
+
+func intEventParam(job Job, name string, def int) (int, error) {
+	str, ok := job.EventParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("event param %s: %w", name, err)
+	}
+	return value, nil
+}
+
+func floatEventParam(job Job, name string, def float64) (float64, error) {
+	str, ok := job.EventParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("event param %s: %w", name, err)
+	}
+	return value, nil
+}
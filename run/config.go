@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tamararankovic/hidera_eval/configfile"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DEFAULT_CONFIG_FILE      = configfile.DEFAULT_CONFIG_FILE
+	DEFAULT_WALLTIME         = "12h"
+	DEFAULT_CONTAINER_MEMORY = "250m"
+	CONFIG_ENV_PREFIX        = configfile.ENV_PREFIX
+)
+
+// Config holds the settings that differ between users of the tool. It is
+// read from hidera.yaml, which analyze reads as well, and every setting can
+// be overridden by a HIDERA_<SETTING> env var and then by its flag. Empty
+// directories fall back to the defaults of the local backend, the cluster
+// backend needs all of them.
+type Config struct {
+	Frontend        string `yaml:"frontend"`
+	Hostname        string `yaml:"hostname"`
+	ExperimentsDir  string `yaml:"experiments_dir"`
+	SourcesDir      string `yaml:"sources_dir"`
+	ToolsDir        string `yaml:"tools_dir"`
+	Walltime        string `yaml:"walltime"`
+	ContainerMemory string `yaml:"container_memory"`
+	ProtocolsFile   string `yaml:"protocols_file"`
+
+	// file is the config file as read, which analyze and plot get as well
+	file []byte
+}
+
+var config = Config{
+	Frontend:        FRONTEND_HOSTNAME,
+	Walltime:        DEFAULT_WALLTIME,
+	ContainerMemory: DEFAULT_CONTAINER_MEMORY,
+}
+
+type configSetting struct {
+	key   string
+	flag  string
+	value *string
+	usage string
+}
+
+func (c *Config) settings() []configSetting {
+	return []configSetting{
+		{"frontend", "frontend", &c.Frontend, "ssh host of the cluster frontend"},
+		{"hostname", "hostname", &c.Hostname, "HOSTNAME exported to the cluster tools, if set"},
+		{"experiments_dir", "experiments-dir", &c.ExperimentsDir, "directory experiment data is written to"},
+		{"sources_dir", "src-dir", &c.SourcesDir, "directory containing the protocol sources"},
+		{"tools_dir", "tools-dir", &c.ToolsDir, "directory containing analyze and plot on the job host"},
+		{"walltime", "walltime", &c.Walltime, "walltime of cluster jobs, e.g. 12h"},
+		{"container_memory", "container-memory", &c.ContainerMemory, "memory limit of protocol containers"},
+		{"protocols_file", "protocols-file", &c.ProtocolsFile, fmt.Sprintf("protocol registry (default %s or ../%s)", DEFAULT_PROTOCOLS_FILE, DEFAULT_PROTOCOLS_FILE)},
+	}
+}
+
+// configFlags registers a flag for every setting, the returned function
+// loads the config once the flags are parsed.
+func configFlags() func() error {
+	configPath := flag.String("config", "", fmt.Sprintf("config file (default %s or ../%s)", DEFAULT_CONFIG_FILE, DEFAULT_CONFIG_FILE))
+	flagValues := map[string]*string{}
+	for _, setting := range config.settings() {
+		flagValues[setting.key] = flag.String(setting.flag, "", setting.usage)
+	}
+
+	return func() error {
+		if err := config.load(*configPath); err != nil {
+			return err
+		}
+		for _, setting := range config.settings() {
+			if value := os.Getenv(CONFIG_ENV_PREFIX + strings.ToUpper(setting.key)); value != "" {
+				*setting.value = value
+			}
+			if value := *flagValues[setting.key]; value != "" {
+				*setting.value = value
+			}
+		}
+		_, err := config.WalltimeDuration()
+		return err
+	}
+}
+
+// load reads the config file at path, or from its default locations if path
+// and HIDERA_CONFIG are empty. A missing default config file is no error.
+func (c *Config) load(path string) error {
+	content, path, err := configfile.Read(path)
+	if err != nil || content == nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, c); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	c.file = content
+	return nil
+}
+
+func (c Config) WalltimeDuration() (time.Duration, error) {
+	walltime, err := time.ParseDuration(c.Walltime)
+	if err != nil {
+		return 0, fmt.Errorf("config walltime: %w", err)
+	}
+	if walltime < time.Minute {
+		return 0, fmt.Errorf("config walltime: %s is shorter than a minute", c.Walltime)
+	}
+	return walltime, nil
+}
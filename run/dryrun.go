@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DryRun stands in for everything a run executes. Commands are written to
+// files under dir, grouped by section (submit, <job>/network, build,
+// <job>/rep_<n>, terminate), instead of being run, and waits only move a
+// virtual clock forward. Jobs run one after another, so rendering the same
+// plan twice gives the same files.
+type DryRun struct {
+	mu      sync.Mutex
+	dir     string
+	section string
+	count   int
+	clock   time.Time
+}
+
+var dryRun *DryRun
+
+func newDryRun(dir string) (*DryRun, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("dry run dir %s is not empty", dir)
+	}
+	d := &DryRun{dir: dir, clock: time.Unix(0, 0)}
+	return d, d.Section("")
+}
+
+// Section sends the commands that follow to their own directory.
+func (d *DryRun) Section(name string) error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.section = name
+	d.count = 0
+	return os.MkdirAll(filepath.Join(d.dir, name), 0777)
+}
+
+// FilePath is the path of a file written for the current section.
+func (d *DryRun) FilePath(name string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return filepath.Join(d.dir, d.section, name)
+}
+
+// recordCmd records the command line followed by the script it is fed on
+// stdin. The command prints nothing.
+func (d *DryRun) recordCmd(cmd *exec.Cmd) error {
+	args := []string{}
+	// the variables the command sets on top of the inherited environment
+	inherited := map[string]bool{}
+	for _, v := range os.Environ() {
+		inherited[v] = true
+	}
+	for _, v := range cmd.Env {
+		if name, value, ok := strings.Cut(v, "="); ok && !inherited[v] {
+			args = append(args, name+"="+shellQuote(value))
+		}
+	}
+	for _, arg := range cmd.Args {
+		args = append(args, shellQuote(arg))
+	}
+	var stdin []byte
+	if cmd.Stdin != nil {
+		var err error
+		stdin, err = io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	return d.record(filepath.Base(cmd.Args[0])+".sh", strings.Join(args, " "), stdin)
+}
+
+// Run, Upload and Download make the dry run the Remote of the cluster
+// backend.
+func (d *DryRun) Run(host, script string, stdout, stderr io.Writer) error {
+	return d.record("ssh.sh", fmt.Sprintf("ssh %s bash -s", host), []byte(script))
+}
+
+func (d *DryRun) Upload(host, path string, content []byte) error {
+	return d.record("upload_"+filepath.Base(path), fmt.Sprintf("upload %s:%s", host, path), content)
+}
+
+func (d *DryRun) Download(host, remoteDir, localDir string) error {
+	return d.record("download.sh", fmt.Sprintf("download %s:%s %s", host, remoteDir, localDir), nil)
+}
+
+// record writes a comment with the command, followed by its input, to the
+// next file of the section.
+func (d *DryRun) record(name, command string, input []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.count++
+	path := filepath.Join(d.dir, d.section, fmt.Sprintf("%03d_%s", d.count, name))
+	content := append([]byte(fmt.Sprintf("# %s\n", command)), input...)
+	return os.WriteFile(path, content, 0666)
+}
+
+func (d *DryRun) now() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.clock
+}
+
+func (d *DryRun) sleep(ctx context.Context, duration time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.clock = d.clock.Add(max(duration, 0))
+	return true
+}
+
+// dryRunBackend answers what only a live cluster knows: job IDs, hosts and
+// node IPs. Everything else is left to the wrapped backend, whose commands
+// the dry run records.
+type dryRunBackend struct {
+	Backend
+	schedulerName string
+	cluster       string
+
+	mu     sync.Mutex
+	nextID int
+}
+
+func newDryRunBackend(inner Backend, schedulerName, cluster string) *dryRunBackend {
+	return &dryRunBackend{
+		Backend:       inner,
+		schedulerName: schedulerName,
+		cluster:       cluster,
+		nextID:        1,
+	}
+}
+
+func (b *dryRunBackend) Submit(plan JobPlan) (*Job, error) {
+	if _, ok := b.Backend.(*clusterBackend); !ok {
+		return b.Backend.Submit(plan)
+	}
+
+	b.mu.Lock()
+	ID := b.nextID
+	b.nextID++
+	b.mu.Unlock()
+
+	walltime, err := config.WalltimeDuration()
+	if err != nil {
+		return &Job{}, err
+	}
+	scheduler, err := newScheduler(b.schedulerName, func(remoteCmd string) (string, error) {
+		_, err := runRemoteCmd(dryRun, config.Frontend, remoteCmd)
+		return strconv.Itoa(ID), err
+	}, walltime)
+	if err != nil {
+		return &Job{}, err
+	}
+	if _, err := scheduler.Submit(plan.FullName(), b.cluster); err != nil {
+		return &Job{}, err
+	}
+	return &Job{JobPlan: plan, ID: ID, Host: fmt.Sprintf("host_%d", ID)}, nil
+}
+
+func (b *dryRunBackend) Reattach(plan JobPlan, ID int, host string) (*Job, error) {
+	return nil, errors.New("no jobs to reattach in a dry run")
+}
+
+func (b *dryRunBackend) WaitRunning(ctx context.Context, jobs []*Job) error {
+	return nil
+}
+
+func (b *dryRunBackend) WriteFile(host, path string, content []byte) error {
+	return dryRun.Upload(host, path, content)
+}
+
+// IPs of cluster nodes networked by oar-p2p are only known once it sets up
+// the network, so they are rendered as placeholders.
+func (b *dryRunBackend) IPs(job Job) []string {
+	cluster, ok := b.Backend.(*clusterBackend)
+	if !ok {
+		return b.Backend.IPs(job)
+	}
+	if _, ok := cluster.network.(*oarP2PNetwork); !ok {
+		return b.Backend.IPs(job)
+	}
+	IPs := make([]string, job.AddressesCount())
+	for i := range IPs {
+		IPs[i] = fmt.Sprintf("ip_%d", i+1)
+	}
+	return IPs
+}
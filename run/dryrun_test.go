@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// TestDryRunLocal renders a small plan on the local backend and compares
+// every file of the dry run with testdata/dry_run_local.
+func TestDryRunLocal(t *testing.T) {
+	testDryRun(t, BACKEND_LOCAL, "", "testdata/dry_run_plan.json", "dry_run_local")
+}
+
+// TestDryRunClusterOAR renders a plan with a latency model, a network profile
+// and a partition on the cluster backend with the OAR scheduler, covering the
+// oarsub, oar-p2p and netem scripts, and compares every file of the dry run
+// with testdata/dry_run_cluster_oar.
+func TestDryRunClusterOAR(t *testing.T) {
+	testDryRun(t, BACKEND_CLUSTER, "moltres", "testdata/dry_run_cluster_plan.json", "dry_run_cluster_oar")
+}
+
+// testDryRun runs the plan at planPath in a dry run on the backend with the
+// OAR scheduler and compares the dry run with the golden directory in
+// testdata, which -update rewrites.
+func testDryRun(t *testing.T, backendName, cluster, planPath, goldenName string) {
+	if err := loadProtocolRegistry("../protocols.json"); err != nil {
+		t.Fatal(err)
+	}
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config.ExperimentsDir = "/srv/hidera/experiments"
+	config.SourcesDir = "/srv/hidera/src"
+	config.ToolsDir = "/srv/hidera/hidera_eval"
+
+	dir := t.TempDir()
+	var err error
+	dryRun, err = newDryRun(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { dryRun = nil }()
+	journal = &Journal{Jobs: map[string]*JournalEntry{}}
+	defer func() { journal = nil }()
+	innerBackend, err := newBackend(backendName, SCHEDULER_OAR, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend = newDryRunBackend(innerBackend, SCHEDULER_OAR, cluster)
+	defer func() { backend = nil }()
+
+	ctx := context.Background()
+	jobs, err := submitJobs(ctx, loadJobPlans(planPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobsRunning(ctx, jobs)
+	setUpNetwork(ctx, jobs)
+	runExperiments(ctx, jobs)
+	if err := terminateJobs(jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", goldenName)
+	if *update {
+		if err := os.RemoveAll(golden); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range readTree(t, dir) {
+			path := filepath.Join(golden, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got := readTree(t, dir)
+	want := readTree(t, golden)
+	for name, content := range want {
+		if _, ok := got[name]; !ok {
+			t.Errorf("%s was not written", name)
+		} else if got[name] != content {
+			t.Errorf("%s differs from the golden file:\n%s", name, got[name])
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s has no golden file", name)
+		}
+	}
+}
+
+// readTree returns the content of every file under dir by its relative path,
+// with dir itself replaced by DRY_RUN_DIR.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[name] = strings.ReplaceAll(string(content), dir, "DRY_RUN_DIR")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
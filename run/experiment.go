@@ -1,113 +1,93 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 )
 
-var protocolNames = map[Protocol]string{
-	PROTOCOL_HIDERA:              "hidera",
-	PROTOCOL_FLOW_UPDATING:       "flow_updating",
-	PROTOCOL_EXTREMA_PROPAGATION: "extrema_propagation",
-	PROTOCOL_RAND_REPORTS:        "rand_reports",
-	PROTOCOL_DIGEST_DIFFUSION:    "digest_diffusion",
-}
-
-var protocolDirs = map[Protocol]string{
-	PROTOCOL_HIDERA:              "hidera",
-	PROTOCOL_FLOW_UPDATING:       "flow_updating",
-	PROTOCOL_EXTREMA_PROPAGATION: "extrema_propagation",
-	PROTOCOL_RAND_REPORTS:        "randomized_reports",
-	PROTOCOL_DIGEST_DIFFUSION:    "digest_diffusion",
-}
-
 func startExperiment(job Job, repetition int) error {
-	protocolName := protocolNames[job.Protocol]
-
 	scriptBuilder := strings.Builder{}
 	scriptBuilder.WriteString("set -e\n\n")
+	scriptBuilder.WriteString(fmt.Sprintf(
+		"rm -rf %s/%s/exp_%d\n",
+		backend.ExperimentsDir(), job.FullName(), repetition,
+	))
 
-	IPs := job.getIPs()
+	IPs := backend.IPs(job)
 
 	for containerIdx := range job.NodesCount {
-		ip := IPs[containerIdx]
-		id := containerIdx + 1
-		name := fmt.Sprintf("node_%d", id)
-		logDirPath := fmt.Sprintf("%s/%s/exp_%d/node_%d", EXPERIMENT_DATA_BASE_PATH, job.FullName(), repetition, id)
-		envFilePath := fmt.Sprintf("%s/%s/.env", EXPERIMENT_DATA_BASE_PATH, job.FullName())
-		peerIDs := []string{}
-		peerIPs := []string{}
-		for _, peerContainerIdx := range job.Graph.Adj[containerIdx] {
-			peerID := peerContainerIdx + 1
-			peerIDs = append(peerIDs, strconv.Itoa(peerID))
-			peerIPs = append(peerIPs, IPs[peerContainerIdx])
-		}
+		scriptBuilder.WriteString(containerRunScript(job, containerIdx+1, IPs, job.Graph.Adj[containerIdx], repetition))
+	}
 
-		scriptBuilder.WriteString(fmt.Sprintf("mkdir -p %s\n", logDirPath))
-		scriptBuilder.WriteString(
-			fmt.Sprintf("docker rm -f %s >/dev/null 2>&1 || true\n", name),
-		)
-		scriptBuilder.WriteString(fmt.Sprintf(`
+	if err := runHostScript(job.Host, scriptBuilder.String()); err != nil {
+		return fmt.Errorf("failed to start experiment %s: %w",
+			job.FullName(), err)
+	}
+
+	return nil
+}
+
+// containerRunScript starts the container of a node, peers are indices of
+// the nodes it is connected to in the overlay.
+func containerRunScript(job Job, id int, IPs []string, peers []int, repetition int) string {
+	spec := protocolSpec(job.Protocol)
+
+	name := containerName(job, id)
+	logDirPath := fmt.Sprintf("%s/%s/exp_%d/node_%d", backend.ExperimentsDir(), job.FullName(), repetition, id)
+	envFilePath := fmt.Sprintf("%s/%s/.env", backend.ExperimentsDir(), job.FullName())
+	peerIDs := []string{}
+	peerIPs := []string{}
+	for _, peerContainerIdx := range peers {
+		peerID := peerContainerIdx + 1
+		peerIDs = append(peerIDs, strconv.Itoa(peerID))
+		peerIPs = append(peerIPs, IPs[peerContainerIdx])
+	}
+
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString(fmt.Sprintf("mkdir -p %s\n", logDirPath))
+	scriptBuilder.WriteString(
+		fmt.Sprintf("docker rm -f %s >/dev/null 2>&1 || true\n", name),
+	)
+	scriptBuilder.WriteString(fmt.Sprintf(`
 docker run -d \
 --name %s \
---network host \
---memory 250m \
+%s \
+--memory %s \
 -e ID=%d \
 -e LISTEN_IP=%s \
--e LISTEN_PORT=9000 \
+-e LISTEN_PORT=%d \
+-e METRICS_PORT=%d \
 -e PEER_IDS=%s \
 -e PEER_IPS=%s \
 --env-file "%s" \
 -v "%s:/var/log/%s" \
 %s:latest
 
-`, name, id, ip,
-			strings.Join(peerIDs, ","),
-			strings.Join(peerIPs, ","),
-			envFilePath,
-			logDirPath,
-			protocolName,
-			protocolName,
-		))
-	}
-
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", job.Host, "bash", "-s",
-	)
-
-	cmd.Stdin = bytes.NewBufferString(scriptBuilder.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to start experiment %s: %w",
-			job.FullName(), err)
-	}
-
-	return nil
+`, name, backend.ContainerNetworkArgs(job, id), config.ContainerMemory, id, IPs[id-1],
+		spec.ListenPort, spec.MetricsPort,
+		strings.Join(peerIDs, ","),
+		strings.Join(peerIPs, ","),
+		envFilePath,
+		logDirPath,
+		spec.Image,
+		spec.Image,
+	))
+	return scriptBuilder.String()
 }
 
 func stopExperiment(job Job) error {
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", job.Host, "bash", "-s",
-	)
+	filter := fmt.Sprintf("name=^%snode_", backend.ContainerPrefix(job))
 
-	cmd.Stdin = bytes.NewBufferString(`
-	docker ps -a -q | xargs -r docker stop
-	docker ps -a -q | xargs -r docker rm
-	`)
-	cmd.Stdout = nil
-	cmd.Stderr = os.Stderr
+	script := fmt.Sprintf(`
+	docker ps -a -q --filter "%s" | xargs -r docker stop
+	docker ps -a -q --filter "%s" | xargs -r docker rm
+	`, filter, filter)
 
-	if err := cmd.Run(); err != nil {
+	if err := backend.RunScript(job.Host, script, nil, os.Stderr); err != nil {
 		return fmt.Errorf("failed to stop experiment %s: %w",
 			job.FullName(), err)
 	}
@@ -122,12 +102,24 @@ type ExperimentRunMetadata struct {
 	StopEventsTs      int64           `json:"events_stop_ts"`
 	StopExperimentTs  int64           `json:"exp_stop_ts"`
 	Events            []EventMetadata `json:"events"`
+	Links             []ResolvedLink  `json:"links,omitempty"`
+	InputValues       []float64       `json:"input_values,omitempty"`
+	TimeToReadyMS     int64           `json:"time_to_ready_ms,omitempty"`
+	Aborted           bool            `json:"aborted,omitempty"`
 }
 
 type EventMetadata struct {
-	EventTs       int64    `json:"event_ts"`
+	Name          string              `json:"event"`
+	EventTs       int64               `json:"event_ts"`
+	ExpectedValue float64             `json:"expected_value"`
+	ExcludeNodes  []string            `json:"exclude_nodes"`
+	Partitions    []PartitionMetadata `json:"partitions,omitempty"`
+}
+
+// PartitionMetadata is the ground truth of one side of a network partition.
+type PartitionMetadata struct {
+	Nodes         []string `json:"nodes"`
 	ExpectedValue float64  `json:"expected_value"`
-	ExcludeNodes  []string `json:"exclude_nodes"`
 }
 
 func saveExperimentRunMetadata(metadata ExperimentRunMetadata) {
@@ -137,61 +129,71 @@ func saveExperimentRunMetadata(metadata ExperimentRunMetadata) {
 		return
 	}
 
-	metadataFilePath := fmt.Sprintf("%s/%s/exp_%d/metadata.json", EXPERIMENT_DATA_BASE_PATH, metadata.Job.FullName(), metadata.Repetition)
-	var script strings.Builder
-	script.WriteString("set -e\n\n")
-
-	script.WriteString(fmt.Sprintf(
-		"cat <<'EOF' > %s\n%s\nEOF\n",
-		metadataFilePath,
-		string(metadataJson),
-	))
-
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", metadata.Job.Host, "bash", "-s",
-	)
+	graphMetrics := ComputeGraphMetrics(&metadata.Job.Graph, metadata.Job.NodesCount)
+	graphMetricsJson, err := json.Marshal(&graphMetrics)
+	if err != nil {
+		log.Println(err)
+		return
+	}
 
-	cmd.Stdin = bytes.NewBufferString(script.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	repetitionDirPath := fmt.Sprintf("%s/%s/exp_%d", backend.ExperimentsDir(), metadata.Job.FullName(), metadata.Repetition)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"metadata.json", append(metadataJson, '\n')},
+		{"graph.json", append(graphMetricsJson, '\n')},
+		{"graph.dot", []byte(metadata.Job.Graph.ToDOT(graphMetrics))},
+	}
 
-	if err := cmd.Run(); err != nil {
-		log.Printf("failed to write metadata file for experiment %s: %v\n", metadata.Job.FullName(), err)
+	for _, file := range files {
+		if err := backend.WriteFile(metadata.Job.Host, repetitionDirPath+"/"+file.name, file.content); err != nil {
+			log.Printf("failed to write %s for experiment %s: %v\n", file.name, metadata.Job.FullName(), err)
+		}
 	}
 }
 
+// analyzePlotAndExport runs analyze and plot on the job host. They are handed
+// the protocol registry and config this run was started with, uploaded next
+// to the experiment, rather than the ones of the tools dir on the host.
 func analyzePlotAndExport(job Job) {
 	scriptBuilder := strings.Builder{}
 
 	scriptBuilder.WriteString("set -e\n\n")
+
+	jobDirPath := fmt.Sprintf("%s/%s", backend.ExperimentsDir(), job.FullName())
+	files := []struct {
+		env     string
+		name    string
+		content []byte
+	}{
+		{"PROTOCOLS_FILE", DEFAULT_PROTOCOLS_FILE, protocolRegistryFile},
+		{"CONFIG", DEFAULT_CONFIG_FILE, config.file},
+	}
+	for _, file := range files {
+		if file.content == nil {
+			continue
+		}
+		filePath := jobDirPath + "/" + file.name
+		if err := backend.WriteFile(job.Host, filePath, file.content); err != nil {
+			log.Printf("failed to upload %s for analyze and plot: %v\n", file.name, err)
+			return
+		}
+		scriptBuilder.WriteString(fmt.Sprintf("export %s%s=%s\n", CONFIG_ENV_PREFIX, file.env, shellQuote(filePath)))
+	}
 	scriptBuilder.WriteString(
-		fmt.Sprintf("cd /home/tamara/hidera_eval/analyze && go run . %s\n", job.ExperimanetName),
+		fmt.Sprintf("cd %s/analyze && go run . %s %s\n", backend.ToolsDir(), job.ExperimanetName, backend.ExperimentsDir()),
 	)
 	scriptBuilder.WriteString(
-		fmt.Sprintf("cd /home/tamara/hidera_eval/plot && source venv/bin/activate && python plot.py  %s\n", job.ExperimanetName),
-	)
-
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", job.Host, "bash", "-s",
+		fmt.Sprintf("cd %s/plot && source venv/bin/activate && python plot.py  %s %s\n", backend.ToolsDir(), job.ExperimanetName, backend.ExperimentsDir()),
 	)
 
-	cmd.Stdin = bytes.NewBufferString(scriptBuilder.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := runHostScript(job.Host, scriptBuilder.String()); err != nil {
 		log.Printf("failed to analzye and plot: %v\n", err)
 		return
 	}
 
-	scpCmd := exec.Command(
-		"scp", "-r",
-		fmt.Sprintf("%s:%s/%s_plots", FRONTEND_HOSTNAME, EXPERIMENT_DATA_BASE_PATH, job.ExperimanetName),
-		fmt.Sprintf("../export/"),
-	)
-	if err := scpCmd.Run(); err != nil {
+	if err := backend.Export(job); err != nil {
 		log.Printf("failed to export plot: %v\n", err)
 	}
 }
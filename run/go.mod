@@ -1,3 +1,13 @@
 module github.com/tamararankovic/hidera_eval/run
 
 go 1.24.2
+
+require (
+	github.com/tamararankovic/hidera_eval/configfile v0.0.0
+	golang.org/x/crypto v0.45.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.38.0 // indirect
+
+replace github.com/tamararankovic/hidera_eval/configfile => ../configfile
@@ -1,17 +1,27 @@
 package main
 
-import "slices"
+import (
+	"math/rand"
+	"slices"
+)
 
+// Graph is the overlay as the nodes know it: Adj lists the peers every node
+// was started with. The initial overlay is symmetric, nodes joined later know
+// their peers without the peers knowing them.
 type Graph struct {
 	Adj [][]int `json:"edges"`
 	Deg []int   `json:"degree"`
 }
 
-func BuildGraph(n, m int) *Graph {
-	g := &Graph{
+func newGraph(n int) *Graph {
+	return &Graph{
 		Adj: make([][]int, n),
 		Deg: make([]int, n),
 	}
+}
+
+func BuildGraph(n, m int) *Graph {
+	g := newGraph(n)
 
 	for i := range n - 1 {
 		g.addEdge(i, i+1)
@@ -35,6 +45,64 @@ func (g *Graph) addEdge(u, v int) {
 	g.Deg[v]++
 }
 
+// addArc records that u knows v but not that v knows u.
+func (g *Graph) addArc(u, v int) {
+	g.Adj[u] = append(g.Adj[u], v)
+	g.Deg[u]++
+}
+
+// undirected returns the overlay with a link wherever either end knows the
+// other, since a node can reach the peers it knows.
+func (g *Graph) undirected() *Graph {
+	links := newGraph(len(g.Adj))
+	for u, neighbors := range g.Adj {
+		for _, v := range neighbors {
+			if !links.isNeighbor(u, v) {
+				links.addEdge(u, v)
+			}
+		}
+	}
+	return links
+}
+
 func (g *Graph) isNeighbor(u, v int) bool {
 	return slices.Contains(g.Adj[u], v)
 }
+
+func (g *Graph) isConnected() bool {
+	n := len(g.Adj)
+	if n == 0 {
+		return true
+	}
+	visited := make([]bool, n)
+	visited[0] = true
+	queue := []int{0}
+	count := 1
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range g.Adj[u] {
+			if !visited[v] {
+				visited[v] = true
+				count++
+				queue = append(queue, v)
+			}
+		}
+	}
+	return count == n
+}
+
+// shuffle returns the same graph with nodes relabeled by a random permutation.
+func (g *Graph) shuffle(rng *rand.Rand) *Graph {
+	n := len(g.Adj)
+	perm := rng.Perm(n)
+	shuffled := newGraph(n)
+	for u := range n {
+		for _, v := range g.Adj[u] {
+			if u < v {
+				shuffled.addEdge(perm[u], perm[v])
+			}
+		}
+	}
+	return shuffled
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type GraphMetrics struct {
+	Nodes                 int                `json:"nodes"`
+	Edges                 int                `json:"edges"`
+	Diameter              int                `json:"diameter"`
+	AvgDegree             float64            `json:"avg_degree"`
+	DegreeDistribution    map[int]int        `json:"degree_distribution"`
+	ClusteringCoefficient float64            `json:"clustering_coefficient"`
+	LocalClustering       map[string]float64 `json:"local_clustering"`
+	Root                  string             `json:"root"`
+	HopDistance           map[string]int     `json:"hop_distance"`
+}
+
+// ComputeGraphMetrics reports the structure of the overlay, with links that
+// only one end knows of counted as links. The root is the node the protocols
+// treat as root, node N of the initial overlay, and unreachable nodes are
+// given a hop distance of -1.
+func ComputeGraphMetrics(g *Graph, rootID int) GraphMetrics {
+	g = g.undirected()
+	n := len(g.Adj)
+	metrics := GraphMetrics{
+		Nodes:              n,
+		DegreeDistribution: map[int]int{},
+		LocalClustering:    map[string]float64{},
+		HopDistance:        map[string]int{},
+	}
+	if n == 0 {
+		return metrics
+	}
+
+	degreeSum := 0
+	for _, deg := range g.Deg {
+		degreeSum += deg
+		metrics.DegreeDistribution[deg]++
+	}
+	metrics.Edges = degreeSum / 2
+	metrics.AvgDegree = float64(degreeSum) / float64(n)
+
+	clusteringSum := 0.0
+	for u := range n {
+		c := g.localClustering(u)
+		metrics.LocalClustering[nodeName(u+1)] = c
+		clusteringSum += c
+	}
+	metrics.ClusteringCoefficient = clusteringSum / float64(n)
+
+	for u := range n {
+		for _, dist := range g.hopDistances(u) {
+			metrics.Diameter = max(metrics.Diameter, dist)
+		}
+	}
+
+	root := rootID - 1
+	metrics.Root = nodeName(root + 1)
+	for u, dist := range g.hopDistances(root) {
+		metrics.HopDistance[nodeName(u+1)] = dist
+	}
+
+	return metrics
+}
+
+func (g *Graph) hopDistances(src int) []int {
+	dist := make([]int, len(g.Adj))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[src] = 0
+	queue := []int{src}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range g.Adj[u] {
+			if dist[v] < 0 {
+				dist[v] = dist[u] + 1
+				queue = append(queue, v)
+			}
+		}
+	}
+	return dist
+}
+
+func (g *Graph) localClustering(u int) float64 {
+	neighbors := g.Adj[u]
+	k := len(neighbors)
+	if k < 2 {
+		return 0
+	}
+	links := 0
+	for i := range k {
+		for j := i + 1; j < k; j++ {
+			if g.isNeighbor(neighbors[i], neighbors[j]) {
+				links++
+			}
+		}
+	}
+	return 2 * float64(links) / float64(k*(k-1))
+}
+
+// ToDOT renders the overlay with nodes named as their containers' log dirs,
+// annotated with their hop distance from the root. Links that only one end
+// knows of point from that end.
+func (g *Graph) ToDOT(metrics GraphMetrics) string {
+	var sb strings.Builder
+	sb.WriteString("graph overlay {\n")
+	for u := range g.Adj {
+		name := nodeName(u + 1)
+		sb.WriteString(fmt.Sprintf("  %s [hops=%d", name, metrics.HopDistance[name]))
+		if name == metrics.Root {
+			sb.WriteString(", shape=doublecircle")
+		}
+		sb.WriteString("];\n")
+	}
+	for u, neighbors := range g.Adj {
+		for _, v := range neighbors {
+			if !g.isNeighbor(v, u) {
+				sb.WriteString(fmt.Sprintf("  %s -- %s [dir=forward];\n", nodeName(u+1), nodeName(v+1)))
+			} else if u < v {
+				sb.WriteString(fmt.Sprintf("  %s -- %s;\n", nodeName(u+1), nodeName(v+1)))
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	INPUT_ID       = "id"       // node i holds value i
+	INPUT_CONSTANT = "constant" // params: value
+	INPUT_LIST     = "list"     // params: values
+	INPUT_UNIFORM  = "uniform"  // params: min, max
+	INPUT_NORMAL   = "normal"   // params: mean, stddev
+	INPUT_ZIPF     = "zipf"     // params: s, v, max
+	INPUT_FILE     = "file"     // params: path
+)
+
+var inputFns = map[string]func(n int, plan JobPlan, rng *rand.Rand) ([]float64, error){
+	INPUT_ID:       IDInput,
+	INPUT_CONSTANT: ConstantInput,
+	INPUT_LIST:     ListInput,
+	INPUT_UNIFORM:  UniformInput,
+	INPUT_NORMAL:   NormalInput,
+	INPUT_ZIPF:     ZipfInput,
+	INPUT_FILE:     FileInput,
+}
+
+func isInputModelValid(model string) bool {
+	_, ok := inputFns[model]
+	return ok || model == ""
+}
+
+// buildInputValues returns the initial input value of every address, nodes
+// joining mid-experiment included, seeded by the plan input seed so every
+// repetition starts from the same values. Without an input model nodes keep
+// the value they start with, which is their ID.
+func buildInputValues(plan JobPlan) ([]float64, error) {
+	model := plan.InputModel
+	if model == "" {
+		model = INPUT_ID
+	}
+	buildFn, ok := inputFns[model]
+	if !ok {
+		return nil, fmt.Errorf("unknown input model %s", model)
+	}
+	rng := rand.New(rand.NewSource(plan.InputSeed))
+	return buildFn(plan.AddressesCount(), plan, rng)
+}
+
+func IDInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = float64(i + 1)
+	}
+	return values, nil
+}
+
+func ConstantInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	value, err := floatInputParam(plan, "value", 1)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = value
+	}
+	return values, nil
+}
+
+func ListInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	values := []float64{}
+	for _, field := range strings.Split(plan.InputParams["values"], ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("input param values: %w", err)
+		}
+		values = append(values, value)
+	}
+	if len(values) < n {
+		return nil, fmt.Errorf("input list has %d values, plan needs %d", len(values), n)
+	}
+	return values[:n], nil
+}
+
+func UniformInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	minValue, err := floatInputParam(plan, "min", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxValue, err := floatInputParam(plan, "max", 100)
+	if err != nil {
+		return nil, err
+	}
+	if maxValue < minValue {
+		return nil, fmt.Errorf("uniform input: max %v < min %v", maxValue, minValue)
+	}
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = minValue + rng.Float64()*(maxValue-minValue)
+	}
+	return values, nil
+}
+
+func NormalInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	mean, err := floatInputParam(plan, "mean", 50)
+	if err != nil {
+		return nil, err
+	}
+	stddev, err := floatInputParam(plan, "stddev", mean/4)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = rng.NormFloat64()*stddev + mean
+	}
+	return values, nil
+}
+
+// ZipfInput draws values in [1, max+1] with P(k) proportional to (v + k)^-s.
+func ZipfInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	s, err := floatInputParam(plan, "s", 1.5)
+	if err != nil {
+		return nil, err
+	}
+	v, err := floatInputParam(plan, "v", 1)
+	if err != nil {
+		return nil, err
+	}
+	maxValue, err := floatInputParam(plan, "max", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if s <= 1 || v < 1 || maxValue < 0 {
+		return nil, fmt.Errorf("zipf input: requires s > 1, v >= 1 and max >= 0")
+	}
+	zipf := rand.NewZipf(rng, s, v, uint64(maxValue))
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = float64(zipf.Uint64() + 1)
+	}
+	return values, nil
+}
+
+// FileInput loads one value per line, in node order, or "node,value" lines
+// where the node is given by its ID or its name. Either may start with a
+// header line.
+func FileInput(n int, plan JobPlan, rng *rand.Rand) ([]float64, error) {
+	path := plan.InputParams["path"]
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, n)
+	set := make([]bool, n)
+	next := 0
+	first := true
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		header := first
+		first = false
+
+		idx := next
+		valueStr := fields[0]
+		if len(fields) > 1 {
+			id, err := strconv.Atoi(strings.TrimPrefix(fields[0], "node_"))
+			if err != nil {
+				// header
+				continue
+			}
+			idx = id - 1
+			valueStr = fields[1]
+		}
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil && header && len(fields) == 1 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("input file %s: %w", path, err)
+		}
+		next++
+		if idx < 0 || idx >= n {
+			continue
+		}
+		values[idx] = value
+		set[idx] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, ok := range set {
+		if !ok {
+			return nil, fmt.Errorf("input file %s: no value for %s", path, nodeName(i+1))
+		}
+	}
+	return values, nil
+}
+
+func floatInputParam(plan JobPlan, name string, def float64) (float64, error) {
+	str, ok := plan.InputParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("input param %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// postInputValues sets the input value of nodes through their metrics
+// endpoint, retrying while freshly started containers come up.
+func postInputValues(job Job, values map[int]float64) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	IPs := backend.IPs(job)
+
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString("set -e\n\n")
+
+	for _, id := range slices.Sorted(maps.Keys(values)) {
+		value := values[id]
+		scriptBuilder.WriteString(fmt.Sprintf(`
+curl -s --retry 10 --retry-connrefused --retry-delay 1 -X POST -H 'Content-Type: text/plain' \
+  --data-binary @- "http://%s:%d/metrics" <<'METRICS'
+%s
+METRICS
+
+`, IPs[id-1], protocolSpec(job.Protocol).MetricsPort, fmt.Sprintf(metricsTemplate, strconv.FormatFloat(value, 'f', -1, 64))))
+	}
+
+	if err := runHostScript(job.Host, scriptBuilder.String()); err != nil {
+		return fmt.Errorf("failed to post metrics: %w", err)
+	}
+	return nil
+}
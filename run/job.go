@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
 	"slices"
@@ -14,25 +17,17 @@ import (
 	"time"
 )
 
+// Protocol is the code of a protocol in the registry.
 type Protocol string
 
-const (
-	PROTOCOL_ALL                 Protocol = "all"
-	PROTOCOL_HIDERA              Protocol = "hi"
-	PROTOCOL_FLOW_UPDATING       Protocol = "fu"
-	PROTOCOL_EXTREMA_PROPAGATION Protocol = "ep"
-	PROTOCOL_RAND_REPORTS        Protocol = "rr"
-	PROTOCOL_DIGEST_DIFFUSION    Protocol = "dd"
-)
-
-var protocols = []Protocol{PROTOCOL_HIDERA, PROTOCOL_FLOW_UPDATING, PROTOCOL_EXTREMA_PROPAGATION, PROTOCOL_RAND_REPORTS, PROTOCOL_DIGEST_DIFFUSION}
+// PROTOCOL_ALL runs a plan with every registered protocol.
+const PROTOCOL_ALL Protocol = "all"
 
 func areJobPlansValid(plans []*JobPlan) bool {
 	for _, planGroup := range groupJobPlans(plans) {
-		count := planGroup[0].NodesCount
-		degree := planGroup[0].AvgDegree
+		first := planGroup[0]
 		for _, plan := range planGroup {
-			if plan.NodesCount != count || plan.AvgDegree != degree || !isJobPlanValid(*plan) {
+			if !sameOverlay(*first, *plan) || !isJobPlanValid(*plan) {
 				return false
 			}
 		}
@@ -49,17 +44,35 @@ func groupJobPlans(plans []*JobPlan) map[string][]*JobPlan {
 	return groups
 }
 
+func sameOverlay(a, b JobPlan) bool {
+	return a.NodesCount == b.NodesCount &&
+		a.AvgDegree == b.AvgDegree &&
+		a.Topology == b.Topology &&
+		a.Seed == b.Seed &&
+		a.TopologyFile == b.TopologyFile &&
+		maps.Equal(a.TopologyParams, b.TopologyParams)
+}
+
 func isJobPlanValid(plan JobPlan) bool {
-	return isProtocolValid(plan.Protocol)
+	return isProtocolValid(plan.Protocol) &&
+		isTopologyValid(plan.Topology) &&
+		isLatencyModelValid(plan.LatencyModel) &&
+		isInputModelValid(plan.InputModel) &&
+		isAggregateValid(plan.Aggregate) &&
+		isReadinessProbeValid(plan.ReadyProbe) &&
+		isNetworkProfileValid(plan.NetworkProfile, plan.AddressesCount()) &&
+		isTimelineValid(plan.Timeline) &&
+		plan.MaxJoins >= 0 &&
+		(plan.TopologyFile == "" || plan.Topology == "")
 }
 
 func isProtocolValid(protocol Protocol) bool {
-	return slices.Contains(append(protocols, PROTOCOL_ALL), protocol)
+	return slices.Contains(append(registeredProtocols(), PROTOCOL_ALL), protocol)
 }
 
 func unwindProtocol(protocol Protocol) []Protocol {
 	if protocol == PROTOCOL_ALL {
-		return slices.Clone(protocols)
+		return registeredProtocols()
 	}
 	return []Protocol{protocol}
 }
@@ -69,55 +82,62 @@ type JobPlan struct {
 	Protocol        Protocol          `json:"protocol"`
 	ExperimanetName string            `json:"exp_name"`
 	NodesCount      int               `json:"nodes_count"`
+	MaxJoins        int               `json:"max_joins"`
 	AvgDegree       int               `json:"avg_degree"`
 	LatencyMS       int               `json:"latency"`
+	LatencyModel    string            `json:"latency_model"`
+	LatencyParams   map[string]string `json:"latency_params"`
+	LatencySeed     int64             `json:"latency_seed"`
 	LossPercentage  int               `json:"loss"`
+	NetworkProfile  *NetworkProfile   `json:"network_profile,omitempty"`
 	Repetitions     int               `json:"repeat"`
 	ExpectedValue   float64           `json:"expected_value"`
+	Aggregate       string            `json:"aggregate"`
+	InputModel      string            `json:"input_model"`
+	InputParams     map[string]string `json:"input_params"`
+	InputSeed       int64             `json:"input_seed"`
 	StabilizationS  int               `json:"stabilization_wait"`
+	ReadyProbe      string            `json:"readiness_probe"`
+	ReadyTimeoutS   int               `json:"readiness_timeout"`
+	ReadyEpsilon    float64           `json:"readiness_epsilon"`
 	EventWaitS      int               `json:"event_wait"`
 	EventName       string            `json:"event"`
 	EventParams     map[string]string `json:"event_params"`
+	Timeline        []TimelineEntry   `json:"timeline"`
 	AfterEventWaitS int               `json:"end_wait"`
 	EnvFile         string            `json:"params"`
+	Topology        string            `json:"topology"`
+	TopologyParams  map[string]string `json:"topology_params"`
+	Seed            int64             `json:"seed"`
+	TopologyFile    string            `json:"topology_file"`
+	TopologyHash    string            `json:"topology_hash"`
 	Graph           Graph             `json:"graph"`
+
+	Sweep       map[string][]json.RawMessage `json:"sweep,omitempty"`
+	SweepName   string                       `json:"sweep_name,omitempty"`
+	SweepParams map[string]json.RawMessage   `json:"sweep_params,omitempty"`
 }
 
 func (jp JobPlan) FullName() string {
 	return fmt.Sprintf("%s_%s", jp.ExperimanetName, jp.Protocol)
 }
 
-func (jp JobPlan) Submit(cluster string) (*Job, error) {
-	jobID, err := submitJob(jp.FullName(), cluster)
-	if err != nil {
-		return &Job{}, err
-	}
-	job := &Job{JobPlan: jp, ID: jobID}
-	host, err := job.resolveHost()
+// AddressesCount is the number of addresses the network is set up with, the
+// initial nodes plus the spare ones nodes joining mid-experiment take.
+func (jp JobPlan) AddressesCount() int {
+	return jp.NodesCount + jp.MaxJoins
+}
+
+func (jp JobPlan) Submit() (*Job, error) {
+	job, err := backend.Submit(jp)
 	if err != nil {
 		return &Job{}, err
 	}
-	job.Host = host
 	log.Printf("Job %s %s (%d) submitted.\n", job.ExperimanetName, job.Protocol, job.ID)
 
 	return job, nil
 }
 
-func submitJob(experimentName, cluster string) (int, error) {
-	remoteCmd := fmt.Sprintf(`
-	export LC_ALL=C LANG=C
-	oarsub -l "{cluster='%s'}/nodes=1,walltime=12:00" \
-		--project %s 'sleep 43200'
-	`, cluster, experimentName)
-
-	out, err := executeRemoteCmd(remoteCmd)
-	if err != nil {
-		return -1, err
-	}
-
-	return extractJobID(out)
-}
-
 type Job struct {
 	JobPlan
 	ID   int    `json:"id"`
@@ -125,55 +145,65 @@ type Job struct {
 }
 
 func (job Job) setUpNetwork() error {
-	matrix := job.makeLatencyMatrix()
+	matrix, err := job.makeLatencyMatrix()
+	if err != nil {
+		return err
+	}
 
 	latencyFilePath := fmt.Sprintf("latency/%d.txt", job.ID)
-	err := job.writeLatencyFile(matrix, latencyFilePath)
+	if dryRun != nil {
+		latencyFilePath = dryRun.FilePath(fmt.Sprintf("latency_%d.txt", job.ID))
+	}
+	err = job.writeLatencyFile(matrix, latencyFilePath)
 	if err != nil {
 		return err
 	}
 
-	os.Setenv("OAR_JOB_ID", strconv.Itoa(job.ID))
-
-	cmd := exec.Command(
-		"oar-p2p",
+	cmd := oarP2PCommand(job.ID,
 		"net", "up",
-		"--addresses", strconv.Itoa(job.NodesCount),
+		"--addresses", strconv.Itoa(job.AddressesCount()),
 		"--latency-matrix", latencyFilePath,
 	)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := runCmd(cmd); err != nil {
 		return fmt.Errorf("Failed to create P2P network for job %s.\n\t%v\n\t%s\n", job.FullName(), err, string(stderr.Bytes()))
 	}
 
+	if job.NetworkProfile != nil {
+		return job.applyNetworkProfile(backend.IPs(job))
+	}
 	return job.addNetworkLoss()
 }
 
-func (job Job) makeLatencyMatrix() [][]int {
-	matrix := make([][]int, job.NodesCount)
+func (job Job) makeLatencyMatrix() ([][]int, error) {
+	if job.LatencyModel != "" && job.LatencyModel != LATENCY_CONSTANT {
+		return buildLatencyMatrix(job.JobPlan)
+	}
+
+	matrix := make([][]int, job.AddressesCount())
 	for i := range matrix {
-		matrix[i] = make([]int, job.NodesCount)
+		matrix[i] = make([]int, job.AddressesCount())
 		for j := range matrix[i] {
 			if i != j {
 				matrix[i][j] = job.LatencyMS
 			}
 		}
 	}
-	return matrix
+	return matrix, nil
 }
 
 func (job Job) writeLatencyFile(matrix [][]int, path string) error {
 	var sb strings.Builder
-	for i := 0; i < job.NodesCount; i++ {
-		for j := 0; j < job.NodesCount; j++ {
+	for i := 0; i < job.AddressesCount(); i++ {
+		for j := 0; j < job.AddressesCount(); j++ {
 			sb.WriteString(strconv.Itoa(matrix[i][j]))
-			if j < job.NodesCount-1 {
+			if j < job.AddressesCount()-1 {
 				sb.WriteString(" ")
 			}
 		}
-		if i < job.NodesCount-1 {
+		if i < job.AddressesCount()-1 {
 			sb.WriteString("\n")
 		}
 	}
@@ -197,16 +227,7 @@ func (job Job) addNetworkLoss() error {
 	'
 	`, job.LossPercentage)
 
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", job.Host, "bash", "-s",
-	)
-
-	cmd.Stdin = bytes.NewBufferString(script)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := runHostScript(job.Host, script); err != nil {
 		return fmt.Errorf("failed to apply loss on %s for job %s: %w",
 			job.Host, job.FullName(), err)
 	}
@@ -214,22 +235,9 @@ func (job Job) addNetworkLoss() error {
 	return nil
 }
 
-func (job Job) resolveHost() (string, error) {
-	remoteCmd := fmt.Sprintf(`
-	export LC_ALL=C LANG=C
-	oarstat -J -fj %d
-	`, job.ID)
-
-	out, err := executeRemoteCmd(remoteCmd)
-	if err != nil {
-		return "", err
-	}
-
-	return extractHost(out)
-}
-
-func (job Job) runExperiment(wg *sync.WaitGroup) {
-	err := job.writeExperimentEnvFile()
+func (job Job) runExperiment(ctx context.Context, wg *sync.WaitGroup) {
+	dryRun.Section(job.FullName() + "/setup")
+	err := job.writeExperimentEnvFile(!journal.HasRepetitions(job))
 	if err != nil {
 		log.Println(err)
 		wg.Done()
@@ -237,30 +245,45 @@ func (job Job) runExperiment(wg *sync.WaitGroup) {
 	}
 
 	for i := range job.Repetitions {
+		if ctx.Err() != nil {
+			break
+		}
 		repetition := i + 1
+		if journal.IsCompleted(job, repetition) {
+			log.Printf("Skipping experiment %s - repetition %d, already completed\n", job.FullName(), repetition)
+			continue
+		}
 		log.Printf("Running experiment %s - repetition %d\n", job.FullName(), repetition)
+		dryRun.Section(fmt.Sprintf("%s/rep_%d", job.FullName(), repetition))
 
-		err := job.runExperimentRepetition(repetition)
+		err := job.runExperimentRepetition(ctx, repetition)
 		if err != nil {
 			log.Printf("Experiment %s error: %v\n", job.FullName(), err)
 		}
+		if ctx.Err() == nil {
+			if err := journal.Finished(job, repetition, err); err != nil {
+				log.Println(err)
+			}
+		}
 	}
 	wg.Done()
 }
 
-func (job Job) writeExperimentEnvFile() error {
+// writeExperimentEnvFile creates the experiment dir, wiping the data of
+// earlier runs unless wipe is false, and copies the env file into it.
+func (job Job) writeExperimentEnvFile(wipe bool) error {
 	experimentDirPath := fmt.Sprintf(
 		"%s/%s",
-		EXPERIMENT_DATA_BASE_PATH,
+		backend.ExperimentsDir(),
 		job.FullName(),
 	)
 
 	var script strings.Builder
 	script.WriteString("set -e\n\n")
-	script.WriteString(fmt.Sprintf(
-		"rm -rf %s && mkdir -p %s\n",
-		experimentDirPath, experimentDirPath,
-	))
+	if wipe {
+		script.WriteString(fmt.Sprintf("rm -rf %s\n", experimentDirPath))
+	}
+	script.WriteString(fmt.Sprintf("mkdir -p %s\n", experimentDirPath))
 
 	if job.EnvFile == "" {
 		return nil
@@ -271,22 +294,14 @@ func (job Job) writeExperimentEnvFile() error {
 		return err
 	}
 
-	script.WriteString(fmt.Sprintf(
-		"cat <<'EOF' > %s/.env\n%s\nEOF\n",
-		experimentDirPath,
-		env,
-	))
-
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", job.Host, "bash", "-s",
-	)
-
-	cmd.Stdin = bytes.NewBufferString(script.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if err := runHostScript(job.Host, script.String()); err != nil {
+		return fmt.Errorf(
+			"failed to create dir for experiment %s: %w",
+			job.FullName(), err,
+		)
+	}
 
-	if err := cmd.Run(); err != nil {
+	if err := backend.WriteFile(job.Host, experimentDirPath+"/.env", append(env, '\n')); err != nil {
 		return fmt.Errorf(
 			"failed to write env file for experiment %s: %w",
 			job.FullName(), err,
@@ -296,47 +311,99 @@ func (job Job) writeExperimentEnvFile() error {
 	return nil
 }
 
-func (job Job) runExperimentRepetition(repetition int) error {
-	err := startExperiment(job, repetition)
+// runExperimentRepetition runs one repetition. If ctx is done midway, the
+// remaining waits and events are skipped, and the containers are stopped after
+// saving the metadata gathered so far, marked as aborted.
+func (job Job) runExperimentRepetition(ctx context.Context, repetition int) error {
+	inputs, err := buildInputValues(job.JobPlan)
+	if err != nil {
+		return err
+	}
+
+	err = startExperiment(job, repetition)
 	if err != nil {
 		err2 := stopExperiment(job)
 		return errors.Join(err, err2)
 	}
+	started := now()
 
 	metadata := ExperimentRunMetadata{Job: job, Repetition: repetition, Events: make([]EventMetadata, 0)}
+	if job.NetworkProfile != nil {
+		metadata.Links = job.NetworkProfile.ResolvedLinks(job.AddressesCount())
+	}
 
-	time.Sleep(time.Duration(job.StabilizationS) * time.Second)
-	metadata.StartExperimentTs = time.Now().UnixNano()
+	state := newRunState(job, repetition, inputs)
 
-	time.Sleep(time.Duration(job.EventWaitS) * time.Second)
-	metadata.StartEventsTs = time.Now().UnixNano()
+	if job.InputModel != "" {
+		initial := map[int]float64{}
+		for i := range job.NodesCount {
+			initial[i+1] = inputs[i]
+		}
+		if err := postInputValues(job, initial); err != nil {
+			err2 := stopExperiment(job)
+			return errors.Join(err, err2)
+		}
+		metadata.InputValues = inputs[:job.NodesCount]
+	}
+	if job.InputModel != "" || job.Aggregate != "" {
+		metadata.Job.ExpectedValue = state.Expected()
+	}
 
-	eventsHandler := eventFns[job.EventName]
-	if eventsHandler != nil {
-		metadata.Events = eventsHandler(job)
+	if job.ReadyProbe != "" {
+		err := waitReady(ctx, job, state)
+		if err != nil && ctx.Err() == nil {
+			err2 := stopExperiment(job)
+			return errors.Join(err, err2)
+		}
+		if err == nil {
+			metadata.TimeToReadyMS = now().Sub(started).Milliseconds()
+		}
+	} else {
+		sleepCtx(ctx, time.Duration(job.StabilizationS)*time.Second)
 	}
-	metadata.StopEventsTs = time.Now().UnixNano()
+	start := now()
+	metadata.StartExperimentTs = start.UnixNano()
 
-	time.Sleep(time.Duration(job.AfterEventWaitS) * time.Second)
-	metadata.StopExperimentTs = time.Now().UnixNano()
+	metadata.Events, metadata.StartEventsTs = runTimeline(ctx, job, state, job.eventTimeline(), start)
+	metadata.StopEventsTs = now().UnixNano()
 
+	sleepCtx(ctx, time.Duration(job.AfterEventWaitS)*time.Second)
+	metadata.StopExperimentTs = now().UnixNano()
+	metadata.Job.Graph = state.Graph()
+
+	if state.IsPartitioned() {
+		if err := backend.Partition(job, nil); err != nil {
+			log.Printf("failed to heal network of experiment %s: %v", job.FullName(), err)
+		}
+	}
+
+	metadata.Aborted = ctx.Err() != nil
 	saveExperimentRunMetadata(metadata)
 
-	analyzePlotAndExport(job)
+	if !metadata.Aborted {
+		analyzePlotAndExport(job)
+	}
 
 	return stopExperiment(job)
 }
 
-func (job Job) getIPs() []string {
-	os.Setenv("OAR_JOB_ID", strconv.Itoa(job.ID))
+// oarP2PCommand makes an oar-p2p command for the job with the given ID. The
+// job is passed in the command's environment rather than the process's, jobs
+// set up and query their networks in parallel.
+func oarP2PCommand(jobID int, args ...string) *exec.Cmd {
+	cmd := exec.Command("oar-p2p", args...)
+	cmd.Env = append(os.Environ(), "OAR_JOB_ID="+strconv.Itoa(jobID))
+	return cmd
+}
 
-	cmd := exec.Command("oar-p2p", "net", "show")
+func (job Job) getIPs() []string {
+	cmd := oarP2PCommand(job.ID, "net", "show")
 
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = nil
 
-	if err := cmd.Run(); err != nil {
+	if err := runCmd(cmd); err != nil {
 		log.Println(err)
 		return []string{}
 	}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Journal records the progress of a run on disk after every change, so that
+// an interrupted run can be resumed with --resume: live jobs are reattached
+// and finished repetitions are skipped. Settings are the flags that decide
+// where the jobs live, by flag name, which a resumed run takes over.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+
+	Args     []string                 `json:"args"`
+	Settings map[string]string        `json:"settings"`
+	Jobs     map[string]*JournalEntry `json:"jobs"`
+}
+
+// JournalEntry is the progress of a job, keyed by the job's full name.
+type JournalEntry struct {
+	ID        int    `json:"id"`
+	Host      string `json:"host"`
+	NetworkUp bool   `json:"network_up"`
+	Completed []int  `json:"completed"`
+	Failed    []int  `json:"failed"`
+}
+
+var journal *Journal
+
+func newJournal(path string, args []string, settings map[string]string) (*Journal, error) {
+	if path == "" {
+		path = fmt.Sprintf("journal_%s.json", time.Now().Format("20060102_150405"))
+	}
+	j := &Journal{path: path, Args: args, Settings: settings, Jobs: map[string]*JournalEntry{}}
+	return j, j.save()
+}
+
+func loadJournal(path string) (*Journal, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", path, err)
+	}
+	if j.Jobs == nil {
+		j.Jobs = map[string]*JournalEntry{}
+	}
+	return j, nil
+}
+
+// save writes the journal to a temporary file first, so a crash never leaves
+// a truncated journal behind. A journal without a path is kept in memory.
+func (j *Journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, j.path)
+}
+
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// restoreSettings sets every setting the journal recorded, and fails if one
+// of them was given another value on the command line.
+func (j *Journal) restoreSettings(settings map[string]*string, given map[string]bool) error {
+	for name, recorded := range j.Settings {
+		value, ok := settings[name]
+		if !ok {
+			continue
+		}
+		if given[name] && *value != recorded {
+			return fmt.Errorf("journal %s was written with --%s=%q, not %q", j.path, name, recorded, *value)
+		}
+		*value = recorded
+	}
+	return nil
+}
+
+// Entry returns a copy of the progress of the job with the given full name.
+func (j *Journal) Entry(name string) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.Jobs[name]
+	if !ok {
+		return JournalEntry{}, false
+	}
+	return *entry, true
+}
+
+func (j *Journal) entry(name string) *JournalEntry {
+	entry, ok := j.Jobs[name]
+	if !ok {
+		entry = &JournalEntry{Completed: []int{}, Failed: []int{}}
+		j.Jobs[name] = entry
+	}
+	return entry
+}
+
+// Submitted records the reservation of a job, a new reservation has no
+// network yet.
+func (j *Journal) Submitted(job Job, reattached bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.entry(job.FullName())
+	if !reattached {
+		entry.NetworkUp = false
+	}
+	entry.ID = job.ID
+	entry.Host = job.Host
+	return j.save()
+}
+
+func (j *Journal) NetworkUp(job Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entry(job.FullName()).NetworkUp = true
+	return j.save()
+}
+
+// Finished records the outcome of a repetition.
+func (j *Journal) Finished(job Job, repetition int, err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.entry(job.FullName())
+	entry.Failed = slices.DeleteFunc(entry.Failed, func(r int) bool { return r == repetition })
+	if err != nil {
+		entry.Failed = append(entry.Failed, repetition)
+	} else if !slices.Contains(entry.Completed, repetition) {
+		entry.Completed = append(entry.Completed, repetition)
+	}
+	return j.save()
+}
+
+// Terminated forgets the reservations of jobs that were cancelled, so that
+// resuming submits them again.
+func (j *Journal) Terminated(jobs []*Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range jobs {
+		entry := j.entry(job.FullName())
+		entry.ID = 0
+		entry.Host = ""
+		entry.NetworkUp = false
+	}
+	return j.save()
+}
+
+func (j *Journal) IsCompleted(job Job, repetition int) bool {
+	entry, ok := j.Entry(job.FullName())
+	return ok && slices.Contains(entry.Completed, repetition)
+}
+
+// HasRepetitions tells whether the job already ran repetitions, whose data
+// must be kept.
+func (j *Journal) HasRepetitions(job Job) bool {
+	entry, ok := j.Entry(job.FullName())
+	return ok && len(entry.Completed)+len(entry.Failed) > 0
+}
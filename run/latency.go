@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	LATENCY_CONSTANT  = "constant"
+	LATENCY_UNIFORM   = "uniform"   // params: min, max
+	LATENCY_NORMAL    = "normal"    // params: mean, stddev
+	LATENCY_EUCLIDEAN = "euclidean" // params: size, ms_per_unit, base
+	LATENCY_REGIONS   = "regions"   // params: regions, intra, inter
+	LATENCY_FILE      = "file"      // params: path
+)
+
+var latencyFns = map[string]func(n int, plan JobPlan, rng *rand.Rand) ([][]int, error){
+	LATENCY_UNIFORM:   UniformLatency,
+	LATENCY_NORMAL:    NormalLatency,
+	LATENCY_EUCLIDEAN: EuclideanLatency,
+	LATENCY_REGIONS:   RegionsLatency,
+	LATENCY_FILE:      FileLatency,
+}
+
+func isLatencyModelValid(model string) bool {
+	_, ok := latencyFns[model]
+	return ok || model == "" || model == LATENCY_CONSTANT
+}
+
+// buildLatencyMatrix builds the matrix of the plan's latency model, seeded by
+// the plan latency seed, so every call for the same plan returns the same
+// matrix.
+func buildLatencyMatrix(plan JobPlan) ([][]int, error) {
+	buildFn, ok := latencyFns[plan.LatencyModel]
+	if !ok {
+		return nil, fmt.Errorf("unknown latency model %s", plan.LatencyModel)
+	}
+	rng := rand.New(rand.NewSource(plan.LatencySeed))
+	return buildFn(plan.AddressesCount(), plan, rng)
+}
+
+func UniformLatency(n int, plan JobPlan, rng *rand.Rand) ([][]int, error) {
+	minMS, err := floatLatencyParam(plan, "min", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxMS, err := floatLatencyParam(plan, "max", float64(2*plan.LatencyMS))
+	if err != nil {
+		return nil, err
+	}
+	if maxMS < minMS {
+		return nil, fmt.Errorf("uniform latency: max %.0f < min %.0f", maxMS, minMS)
+	}
+	return symmetricMatrix(n, func(i, j int) float64 {
+		return minMS + rng.Float64()*(maxMS-minMS)
+	}), nil
+}
+
+func NormalLatency(n int, plan JobPlan, rng *rand.Rand) ([][]int, error) {
+	mean, err := floatLatencyParam(plan, "mean", float64(plan.LatencyMS))
+	if err != nil {
+		return nil, err
+	}
+	stddev, err := floatLatencyParam(plan, "stddev", mean/4)
+	if err != nil {
+		return nil, err
+	}
+	return symmetricMatrix(n, func(i, j int) float64 {
+		return math.Max(rng.NormFloat64()*stddev+mean, 0)
+	}), nil
+}
+
+// EuclideanLatency places nodes uniformly at random on a size x size plane
+// and derives latency from the distance between them.
+func EuclideanLatency(n int, plan JobPlan, rng *rand.Rand) ([][]int, error) {
+	size, err := floatLatencyParam(plan, "size", 100)
+	if err != nil {
+		return nil, err
+	}
+	msPerUnit, err := floatLatencyParam(plan, "ms_per_unit", 1)
+	if err != nil {
+		return nil, err
+	}
+	base, err := floatLatencyParam(plan, "base", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	for i := range n {
+		xs[i] = rng.Float64() * size
+		ys[i] = rng.Float64() * size
+	}
+	return symmetricMatrix(n, func(i, j int) float64 {
+		return base + math.Hypot(xs[i]-xs[j], ys[i]-ys[j])*msPerUnit
+	}), nil
+}
+
+// RegionsLatency assigns nodes to regions at random, nodes in the same region
+// are intra ms apart and nodes in different regions inter ms apart.
+func RegionsLatency(n int, plan JobPlan, rng *rand.Rand) ([][]int, error) {
+	regions, err := floatLatencyParam(plan, "regions", 3)
+	if err != nil {
+		return nil, err
+	}
+	intra, err := floatLatencyParam(plan, "intra", 5)
+	if err != nil {
+		return nil, err
+	}
+	inter, err := floatLatencyParam(plan, "inter", float64(plan.LatencyMS))
+	if err != nil {
+		return nil, err
+	}
+	if regions < 1 {
+		return nil, errors.New("regions latency: at least one region required")
+	}
+
+	region := make([]int, n)
+	for i := range n {
+		region[i] = rng.Intn(int(regions))
+	}
+	return symmetricMatrix(n, func(i, j int) float64 {
+		if region[i] == region[j] {
+			return intra
+		}
+		return inter
+	}), nil
+}
+
+// FileLatency loads a whitespace separated matrix in ms, as in the King and
+// PlanetLab traces. Larger matrices are sampled down to a random subset of
+// hosts and missing measurements (negative values) are replaced by the mean
+// of the measured ones.
+func FileLatency(n int, plan JobPlan, rng *rand.Rand) ([][]int, error) {
+	path := plan.LatencyParams["path"]
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]float64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		row := []float64{}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("latency file %s: %w", path, err)
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		if len(row) != len(rows) {
+			return nil, fmt.Errorf("latency file %s: row %d has %d values, expected %d", path, i+1, len(row), len(rows))
+		}
+	}
+	if len(rows) < n {
+		return nil, fmt.Errorf("latency file %s: has %d hosts, plan needs %d", path, len(rows), n)
+	}
+
+	measuredSum, measuredCount := 0.0, 0
+	for i, row := range rows {
+		for j, value := range row {
+			if i != j && value >= 0 {
+				measuredSum += value
+				measuredCount++
+			}
+		}
+	}
+	if measuredCount == 0 {
+		return nil, fmt.Errorf("latency file %s: no measurements", path)
+	}
+	mean := measuredSum / float64(measuredCount)
+
+	hosts := rng.Perm(len(rows))[:n]
+	matrix := make([][]int, n)
+	for i := range n {
+		matrix[i] = make([]int, n)
+		for j := range n {
+			if i == j {
+				continue
+			}
+			value := rows[hosts[i]][hosts[j]]
+			if value < 0 {
+				value = mean
+			}
+			matrix[i][j] = int(math.Round(value))
+		}
+	}
+	return matrix, nil
+}
+
+func symmetricMatrix(n int, latency func(i, j int) float64) [][]int {
+	matrix := make([][]int, n)
+	for i := range matrix {
+		matrix[i] = make([]int, n)
+	}
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			value := int(math.Round(latency(i, j)))
+			matrix[i][j] = value
+			matrix[j][i] = value
+		}
+	}
+	return matrix
+}
+
+func floatLatencyParam(plan JobPlan, name string, def float64) (float64, error) {
+	str, ok := plan.LatencyParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("latency param %s: %w", name, err)
+	}
+	return value, nil
+}
+
+func (jp JobPlan) latencyDescription() string {
+	if jp.LatencyModel == "" || jp.LatencyModel == LATENCY_CONSTANT {
+		return fmt.Sprintf("%dms", jp.LatencyMS)
+	}
+	return fmt.Sprintf("%s%v", jp.LatencyModel, jp.LatencyParams)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+const LOCAL_HOSTNAME = "localhost"
+
+// localBackend runs every job on the local Docker daemon, connecting the
+// nodes through network holder containers.
+type localBackend struct {
+	network        *holderNetwork
+	experimentsDir string
+	sourcesDir     string
+	toolsDir       string
+
+	mu     sync.Mutex
+	nextID int
+}
+
+func newLocalBackend(experimentsDir, sourcesDir, toolsDir string) (*localBackend, error) {
+	if experimentsDir == "" {
+		experimentsDir = "../experiments"
+	}
+	experimentsDir, err := filepath.Abs(experimentsDir)
+	if err != nil {
+		return nil, err
+	}
+	if sourcesDir == "" {
+		sourcesDir, err = os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sourcesDir, err = filepath.Abs(sourcesDir)
+	if err != nil {
+		return nil, err
+	}
+	if toolsDir == "" {
+		toolsDir = ".."
+	}
+	toolsDir, err = filepath.Abs(toolsDir)
+	if err != nil {
+		return nil, err
+	}
+	b := &localBackend{
+		experimentsDir: experimentsDir,
+		sourcesDir:     sourcesDir,
+		toolsDir:       toolsDir,
+		nextID:         1,
+	}
+	b.network = &holderNetwork{run: b.RunScript}
+	return b, nil
+}
+
+func (b *localBackend) Submit(plan JobPlan) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := &Job{JobPlan: plan, ID: b.nextID, Host: LOCAL_HOSTNAME}
+	b.nextID++
+	return job, nil
+}
+
+// Reattach takes over a job of an earlier run whose network still exists.
+func (b *localBackend) Reattach(plan JobPlan, ID int, host string) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := &Job{JobPlan: plan, ID: ID, Host: LOCAL_HOSTNAME}
+	if err := runCmd(exec.Command("docker", "network", "inspect", b.network.networkName(*job))); err != nil {
+		return nil, fmt.Errorf("network %s: %w", b.network.networkName(*job), err)
+	}
+	b.nextID = max(b.nextID, ID+1)
+	return job, nil
+}
+
+func (b *localBackend) WaitRunning(ctx context.Context, jobs []*Job) error {
+	return nil
+}
+
+func (b *localBackend) SetUpNetwork(job Job) error {
+	return b.network.SetUp(job)
+}
+
+func (b *localBackend) IPs(job Job) []string {
+	return b.network.IPs(job)
+}
+
+func (b *localBackend) ContainerPrefix(job Job) string {
+	return b.network.ContainerPrefix(job)
+}
+
+func (b *localBackend) ContainerNetworkArgs(job Job, nodeID int) string {
+	return b.network.ContainerNetworkArgs(job, nodeID)
+}
+
+func (b *localBackend) Partition(job Job, partitions [][]int) error {
+	return b.network.Partition(job, partitions)
+}
+
+func (b *localBackend) RunScript(host, script string, stdout, stderr io.Writer) error {
+	cmd := exec.Command("bash", "-s")
+
+	cmd.Stdin = bytes.NewBufferString(script)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return runCmd(cmd)
+}
+
+func (b *localBackend) WriteFile(host, path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0666)
+}
+
+func (b *localBackend) Export(job Job) error {
+	cmd := exec.Command(
+		"cp", "-r",
+		fmt.Sprintf("%s/%s_plots", b.experimentsDir, job.ExperimanetName),
+		"../export/",
+	)
+	return runCmd(cmd)
+}
+
+func (b *localBackend) Terminate(jobs []*Job) error {
+	log.Println("*** Tearing down local jobs ***")
+
+	for _, job := range jobs {
+		if err := b.network.TearDown(*job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *localBackend) ExperimentsDir() string {
+	return b.experimentsDir
+}
+
+func (b *localBackend) SourcesDir() string {
+	return b.sourcesDir
+}
+
+func (b *localBackend) ToolsDir() string {
+	return b.toolsDir
+}
@@ -1,55 +1,181 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"strconv"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 const (
-	FRONTEND_HOSTNAME         = "nova_cluster"
-	HOSTNAME                  = "tamara"
-	JOB_STATE_RUNNING         = "R"
-	EXPERIMENT_DATA_BASE_PATH = "/home/tamara/experiments"
+	FRONTEND_HOSTNAME = "nova_cluster"
+	JOB_STATE_RUNNING = "R"
 )
 
+// JOB_STATES_WAITING are the OAR and Slurm states of jobs waiting for resources.
+var JOB_STATES_WAITING = []string{"W", "PD"}
+
 func main() {
-	if len(os.Args) < 3 {
-		log.Fatal("Usage: go run . <plan-file> <cluster>")
+	backendName := flag.String("backend", BACKEND_CLUSTER, "where to run the jobs: cluster or local")
+	schedulerName := flag.String("scheduler", SCHEDULER_OAR, "cluster scheduler: oar or slurm")
+	journalPath := flag.String("journal", "", "file the run journal is written to (default journal_<time>.json)")
+	resumePath := flag.String("resume", "", "journal of an interrupted run to resume")
+	dryRunFlag := flag.Bool("dry-run", false, "write every command of the run to --dry-run-dir instead of executing it")
+	dryRunDir := flag.String("dry-run-dir", "dry_run", "directory a dry run writes the commands to")
+
+	loadConfig := configFlags()
+
+	var err error
+	args := parseArgs()
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadProtocolRegistry(config.ProtocolsFile); err != nil {
+		log.Fatal(err)
+	}
+	// where the jobs of a run live, which a resumed run must not change
+	settings := map[string]*string{
+		"backend":         backendName,
+		"scheduler":       schedulerName,
+		"experiments-dir": &config.ExperimentsDir,
+		"src-dir":         &config.SourcesDir,
+	}
+	if *resumePath != "" {
+		journal, err = loadJournal(*resumePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(args) == 0 {
+			args = journal.Args
+		}
+		given := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+		if err := journal.restoreSettings(settings, given); err != nil {
+			log.Fatal(err)
+		}
+	}
+	settingValues := map[string]string{}
+	for name, value := range settings {
+		settingValues[name] = *value
+	}
+	if len(args) < 1 || (*backendName == BACKEND_CLUSTER && len(args) < 2) {
+		log.Fatal("Usage: go run . <plan-file> [<cluster>] [--backend=cluster|local] [--scheduler=oar|slurm] [--config=<file>] [--experiments-dir=<dir>] [--src-dir=<dir>] [--journal=<file>] [--resume=<journal>] [--dry-run] [--dry-run-dir=<dir>]")
 	}
 
-	planFilePath := os.Args[1]
-	cluster := os.Args[2]
+	planFilePath := args[0]
+	cluster := ""
+	if len(args) > 1 {
+		cluster = args[1]
+	}
+
+	if *dryRunFlag {
+		dryRun, err = newDryRun(*dryRunDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Dry run, writing commands to %s\n", *dryRunDir)
+	}
+
+	if dryRun != nil {
+		// a dry run keeps the journal in memory, so a journal it resumes
+		// from is left as it is
+		if journal == nil {
+			journal = &Journal{Args: args, Settings: settingValues, Jobs: map[string]*JournalEntry{}}
+		}
+		journal.path = ""
+	} else if journal == nil {
+		journal, err = newJournal(*journalPath, args, settingValues)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if journal.Path() != "" {
+		log.Printf("Run journal: %s\n", journal.Path())
+	}
+
+	backend, err = newBackend(*backendName, *schedulerName, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dryRun != nil {
+		backend = newDryRunBackend(backend, *schedulerName, cluster)
+	}
 
 	exportEnvVars()
 
 	plans := loadJobPlans(planFilePath)
 
-	jobs, err := submitJobs(plans, cluster)
+	ctx := interruptContext()
+
+	jobs, err := submitJobs(ctx, plans)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	waitJobsState(jobs, JOB_STATE_RUNNING, 5, 12)
+	waitJobsRunning(ctx, jobs)
+
+	setUpNetwork(ctx, jobs)
 
-	setUpNetwork(jobs)
+	runExperiments(ctx, jobs)
 
-	runExperiments(jobs)
+	terminateJobs(jobs)
+}
+
+// interruptContext is done on the first SIGINT or SIGTERM, which lets the
+// runner stop the experiments and tear down the jobs. A second signal kills
+// the runner right away.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		log.Println("*** Interrupted, tearing down (interrupt again to exit immediately) ***")
+	}()
+	return ctx
+}
 
-	terminateAllJobs(jobs)
+// exitIfInterrupted tears down the jobs and exits if ctx is done.
+func exitIfInterrupted(ctx context.Context, jobs []*Job) {
+	if ctx.Err() == nil {
+		return
+	}
+	if err := terminateJobs(jobs); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(1)
+}
+
+// parseArgs parses flags wherever they appear on the command line and
+// returns the remaining positional arguments.
+func parseArgs() []string {
+	positional := []string{}
+	args := os.Args[1:]
+	for {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
 }
 
 func exportEnvVars() {
-	os.Setenv("FRONTEND_HOSTNAME", FRONTEND_HOSTNAME)
-	os.Setenv("HOSTNAME", HOSTNAME)
+	os.Setenv("FRONTEND_HOSTNAME", config.Frontend)
+	if config.Hostname != "" {
+		os.Setenv("HOSTNAME", config.Hostname)
+	}
 }
 
 func loadJobPlans(path string) []*JobPlan {
@@ -66,46 +192,84 @@ func loadJobPlans(path string) []*JobPlan {
 		log.Fatal(err)
 	}
 
+	jobPlans, err = expandSweeps(jobPlans)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if !areJobPlansValid(jobPlans) {
 		log.Fatal("job plans invalid")
 	}
 
-	attachGraphs(jobPlans)
+	err = attachGraphs(jobPlans)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	return unwindPlans(jobPlans)
+	jobPlans, err = unwindPlans(jobPlans)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return jobPlans
 }
 
-func attachGraphs(plans []*JobPlan) {
-	for _, planGroup := range groupJobPlans(plans) {
-		count := planGroup[0].NodesCount
-		degree := planGroup[0].AvgDegree
-		graph := BuildGraph(count, degree)
+func attachGraphs(plans []*JobPlan) error {
+	for group, planGroup := range groupJobPlans(plans) {
+		var graph *Graph
+		var hash string
+		var err error
+		if planGroup[0].TopologyFile != "" {
+			graph, hash, err = LoadTopologyFile(planGroup[0].TopologyFile, planGroup[0].NodesCount)
+		} else {
+			graph, err = BuildTopology(*planGroup[0])
+		}
+		if err != nil {
+			return fmt.Errorf("overlay group %s: %w", group, err)
+		}
 		for i := range planGroup {
 			planGroup[i].Graph = *graph
+			planGroup[i].TopologyHash = hash
 		}
 	}
+	return nil
 }
 
-func unwindPlans(plans []*JobPlan) []*JobPlan {
+// unwindPlans makes a plan per protocol. Jobs are named after their plans,
+// so two plans that end up with the same name, like sweep values that only
+// differ in characters job names leave out, are an error.
+func unwindPlans(plans []*JobPlan) ([]*JobPlan, error) {
 	unwound := make([]*JobPlan, 0)
+	names := map[string]bool{}
 	for _, plan := range plans {
 		for _, protocol := range unwindProtocol(plan.Protocol) {
 			cp := *plan
 			cp.Protocol = protocol
+			if cp.EnvFile == "" {
+				cp.EnvFile = protocolSpec(protocol).Params
+			}
+			if names[cp.FullName()] {
+				return nil, fmt.Errorf("more than one plan of job %s, exp_name or sweep values must tell them apart", cp.FullName())
+			}
+			names[cp.FullName()] = true
 			unwound = append(unwound, &cp)
 		}
 	}
-	return unwound
+	return unwound, nil
 }
 
-func submitJobs(plans []*JobPlan, cluster string) ([]*Job, error) {
+func submitJobs(ctx context.Context, plans []*JobPlan) ([]*Job, error) {
 	log.Println("*** Submitting jobs ***")
 
+	dryRun.Section("submit")
 	jobs := []*Job{}
 	for _, plan := range plans {
-		job, err := plan.Submit(cluster)
+		exitIfInterrupted(ctx, jobs)
+		job, reattached, err := reattachOrSubmit(plan)
+		if err == nil {
+			err = journal.Submitted(*job, reattached)
+		}
 		if err != nil {
-			err2 := terminateAllJobs(jobs)
+			err2 := terminateJobs(jobs)
 			return []*Job{}, errors.Join(err, err2)
 		}
 		jobs = append(jobs, job)
@@ -113,58 +277,119 @@ func submitJobs(plans []*JobPlan, cluster string) ([]*Job, error) {
 	return jobs, nil
 }
 
-func waitJobsState(jobs []*Job, state string, intervalS int, retry int) {
+// reattachOrSubmit picks up the job the journal holds for the plan if the
+// backend still has it, and submits a new one otherwise.
+func reattachOrSubmit(plan *JobPlan) (*Job, bool, error) {
+	entry, ok := journal.Entry(plan.FullName())
+	if ok && entry.ID != 0 {
+		job, err := backend.Reattach(*plan, entry.ID, entry.Host)
+		if err == nil {
+			log.Printf("Job %s %s (%d) reattached.\n", job.ExperimanetName, job.Protocol, job.ID)
+			return job, true, nil
+		}
+		log.Printf("Can't reattach job %s (%d), submitting it again: %v\n", plan.FullName(), entry.ID, err)
+	}
+	job, err := plan.Submit()
+	return job, false, err
+}
+
+func terminateJobs(jobs []*Job) error {
+	dryRun.Section("terminate")
+	err := backend.Terminate(jobs)
+	return errors.Join(err, journal.Terminated(jobs))
+}
+
+func waitJobsRunning(ctx context.Context, jobs []*Job) {
 	log.Println("*** Waiting jobs ***")
 
-	remoteCmd := `
-		export LC_ALL=C LANG=C
-		oarstat -u $USER
-	`
+	err := backend.WaitRunning(ctx, jobs)
+	exitIfInterrupted(ctx, jobs)
+	for _, job := range jobs {
+		if err != nil {
+			break
+		}
+		// the hosts are known now
+		err = journal.Submitted(*job, true)
+	}
+	if err != nil {
+		err2 := terminateJobs(jobs)
+		log.Fatal(errors.Join(err, err2))
+	}
+}
+
+func waitJobsState(ctx context.Context, scheduler Scheduler, jobs []*Job, state string, intervalS int, retry int) error {
 	for range retry {
-		time.Sleep(time.Duration(intervalS) * time.Second)
+		if !sleepCtx(ctx, time.Duration(intervalS)*time.Second) {
+			return ctx.Err()
+		}
 
-		out, err := executeRemoteCmd(remoteCmd)
+		jobIDs := []int{}
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.ID)
+		}
+		jobStates, err := scheduler.States(jobIDs)
 		if err != nil {
 			log.Println(err)
-			continue
 		}
 
-		states := extractJobStates(out)
-		if allEqual(states, state) {
+		states := []string{}
+		for _, job := range jobs {
+			jobState, ok := jobStates[job.ID]
+			if !ok {
+				log.Printf("job %d not found\n", job.ID)
+				continue
+			}
+			states = append(states, jobState)
+		}
+
+		if len(states) == len(jobs) && allEqual(states, state) {
 			log.Printf("All jobs in state %s, done!\n", state)
-			return
+			return nil
 		}
 
 		log.Printf("Waiting for jobs to be in the state %s, sleeping for %ds ...\n", state, intervalS)
 	}
-	err := terminateAllJobs(jobs)
-	if err != nil {
-		log.Println(err)
-	}
-	log.Fatalf("Wait job state %s: max attempts exceeded, exiting ...\n", state)
+	return fmt.Errorf("wait job state %s: max attempts exceeded", state)
 }
 
-func setUpNetwork(jobs []*Job) {
+func setUpNetwork(ctx context.Context, jobs []*Job) {
 	for _, job := range jobs {
-		err := job.setUpNetwork()
+		exitIfInterrupted(ctx, jobs)
+		if entry, _ := journal.Entry(job.FullName()); entry.NetworkUp {
+			log.Printf("Network of job %s is already up\n", job.FullName())
+			continue
+		}
+		dryRun.Section(job.FullName() + "/network")
+		err := backend.SetUpNetwork(*job)
+		if err == nil {
+			err = journal.NetworkUp(*job)
+		}
 		if err != nil {
-			err2 := terminateAllJobs(jobs)
+			err2 := terminateJobs(jobs)
 			log.Fatal(errors.Join(err, err2))
 		}
-		log.Printf("Network set up for job %s: nodes=%d, latency=%dms, loss=%d%%\n", job.FullName(), job.NodesCount, job.LatencyMS, job.LossPercentage)
+		log.Printf("Network set up for job %s: nodes=%d, latency=%s, loss=%d%%\n", job.FullName(), job.NodesCount, job.latencyDescription(), job.LossPercentage)
 	}
 }
 
-func runExperiments(jobs []*Job) {
+func runExperiments(ctx context.Context, jobs []*Job) {
+	dryRun.Section("build")
 	err := buildImages(jobs[0].Host)
+	exitIfInterrupted(ctx, jobs)
 	if err != nil {
-		log.Fatal(err)
+		err2 := terminateJobs(jobs)
+		log.Fatal(errors.Join(err, err2))
 	}
 
 	wg := &sync.WaitGroup{}
 	for _, job := range jobs {
 		wg.Add(1)
-		go job.runExperiment(wg)
+		if dryRun != nil {
+			// one job after another, so the output is the same every time
+			job.runExperiment(ctx, wg)
+			continue
+		}
+		go job.runExperiment(ctx, wg)
 	}
 	wg.Wait()
 }
@@ -174,61 +399,34 @@ func buildImages(host string) error {
 
 	scriptBuilder := strings.Builder{}
 
-	for protocol, dir := range protocolDirs {
-		name := protocolNames[protocol]
+	for _, spec := range protocolRegistry {
 		scriptBuilder.WriteString(
-			fmt.Sprintf("docker build -t %s:latest /home/tamara/%s\n", name, dir),
+			fmt.Sprintf("docker build -t %s:latest %s/%s\n", spec.Image, backend.SourcesDir(), spec.BuildContext),
 		)
 	}
 
-	cmd := exec.Command(
-		"ssh", FRONTEND_HOSTNAME,
-		"ssh", "-o", "StrictHostKeyChecking=no", host, "bash", "-s",
-	)
-
-	cmd.Stdin = bytes.NewBufferString(scriptBuilder.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := runHostScript(host, scriptBuilder.String()); err != nil {
 		return fmt.Errorf("failed to build container images: %w", err)
 	}
 	return nil
 }
 
-func terminateAllJobs(jobs []*Job) error {
+// terminateAllJobs brings down the network and cancels every job, carrying on
+// past failures so that no reservation is left behind.
+func terminateAllJobs(scheduler Scheduler, network Network, jobs []*Job) error {
 	log.Println("*** Terminating all jobs ***")
 
+	var errs error
 	for _, job := range jobs {
 		fmt.Printf("Processing job %s...\n", job.FullName())
 
-		if err := os.Setenv("OAR_JOB_ID", strconv.Itoa(job.ID)); err != nil {
-			return err
-		}
-
-		fmt.Printf("Bringing down local P2P network for job %s...\n", job.FullName())
+		errs = errors.Join(errs, network.TearDown(*job))
 
-		cmd := exec.Command("oar-p2p", "net", "down")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		fmt.Printf("Deleting job %s...\n", job.FullName())
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to bring down P2P network for job %s: %w", job.FullName(), err)
-		}
-
-		fmt.Printf("Deleting OAR job %s...\n", job.FullName())
-
-		delCmd := exec.Command(
-			"ssh",
-			FRONTEND_HOSTNAME,
-			"oardel", strconv.Itoa(job.ID),
-		)
-		delCmd.Stdout = nil
-		delCmd.Stderr = nil
-
-		if err := delCmd.Run(); err != nil {
+		if err := scheduler.Cancel(job.ID); err != nil {
 			fmt.Printf("Failed to delete job %s remotely\n", job.FullName())
 		}
 	}
-	return nil
+	return errs
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	HOLDER_IMAGE        = "nicolaka/netshoot"
+	HOLDER_NETWORK_BASE = 100
+)
+
+// Network connects the components of a job and shapes the traffic between
+// them.
+type Network interface {
+	SetUp(job Job) error
+	IPs(job Job) []string
+	ContainerPrefix(job Job) string
+	ContainerNetworkArgs(job Job, nodeID int) string
+	Partition(job Job, partitions [][]int) error
+	TearDown(job Job) error
+}
+
+// oarP2PNetwork is the network oar-p2p sets up on the node of an OAR job. The
+// addresses live on the host, so the components share its network namespace.
+type oarP2PNetwork struct{}
+
+func (n *oarP2PNetwork) SetUp(job Job) error {
+	return job.setUpNetwork()
+}
+
+func (n *oarP2PNetwork) IPs(job Job) []string {
+	return job.getIPs()
+}
+
+func (n *oarP2PNetwork) ContainerPrefix(job Job) string {
+	return ""
+}
+
+func (n *oarP2PNetwork) ContainerNetworkArgs(job Job, nodeID int) string {
+	return "--network host"
+}
+
+// Partition drops traffic between the components on the job host, nil
+// partitions heal the network.
+func (n *oarP2PNetwork) Partition(job Job, partitions [][]int) error {
+	rules := []string{}
+	for _, pair := range crossPartitionPairs(backend.IPs(job), partitions) {
+		rules = append(rules, fmt.Sprintf("-s %s -d %s", pair[0], pair[1]))
+	}
+
+	script := fmt.Sprintf(`
+docker run --rm -i --net=host --privileged local/oar-p2p-networking bash -s <<'PARTITION'
+set -e
+%sPARTITION
+`, partitionChainScript(partitionChainName(job), rules))
+
+	return runHostScript(job.Host, script)
+}
+
+func (n *oarP2PNetwork) TearDown(job Job) error {
+	fmt.Printf("Bringing down P2P network for job %s...\n", job.FullName())
+
+	cmd := oarP2PCommand(job.ID, "net", "down")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := runCmd(cmd); err != nil {
+		return fmt.Errorf("failed to bring down P2P network for job %s: %w", job.FullName(), err)
+	}
+	return nil
+}
+
+// holderNetwork gives each node a long-lived network holder container on the
+// job host that owns its IP address and netem configuration. Components join
+// the holder's network namespace, so the network survives container restarts
+// between repetitions. It only needs Docker on the host, and runs its scripts
+// there with run.
+type holderNetwork struct {
+	run func(host, script string, stdout, stderr io.Writer) error
+}
+
+func (n *holderNetwork) SetUp(job Job) error {
+	IPs := n.IPs(job)
+	matrix, err := job.makeLatencyMatrix()
+	if err != nil {
+		return err
+	}
+
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString("set -e\n\n")
+	scriptBuilder.WriteString(n.teardownScript(job))
+	scriptBuilder.WriteString(fmt.Sprintf(
+		"docker network create --subnet %s %s >/dev/null\n",
+		n.subnet(job), n.networkName(job),
+	))
+
+	for i := range job.AddressesCount() {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"docker run -d --name %s --network %s --ip %s --cap-add NET_ADMIN %s sleep infinity >/dev/null\n",
+			n.holderName(job, i+1), n.networkName(job), IPs[i], HOLDER_IMAGE,
+		))
+	}
+
+	for i := range job.AddressesCount() {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"docker exec -i %s sh -s <<'EOF'\n%sEOF\n",
+			n.holderName(job, i+1), job.netemScript(IPs, matrix[i], i),
+		))
+	}
+
+	var stderr bytes.Buffer
+	if err := n.run(job.Host, scriptBuilder.String(), nil, &stderr); err != nil {
+		return fmt.Errorf("Failed to create network for job %s.\n\t%v\n\t%s\n", job.FullName(), err, stderr.String())
+	}
+	return nil
+}
+
+// netemScript shapes egress traffic of node src so that packets to every
+// other node get the delay from the latency matrix row and the impairments
+// of the link between them.
+func (job Job) netemScript(IPs []string, row []int, src int) string {
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString("set -e\n")
+	scriptBuilder.WriteString("tc qdisc del dev eth0 root 2>/dev/null || true\n")
+	scriptBuilder.WriteString("tc qdisc add dev eth0 root handle 1: htb default 1\n")
+	scriptBuilder.WriteString("tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit\n")
+	for dst, ip := range IPs {
+		if dst == src {
+			continue
+		}
+		classID := dst + 10
+		scriptBuilder.WriteString(fmt.Sprintf("tc class add dev eth0 parent 1: classid 1:%x htb rate 10gbit\n", classID))
+		scriptBuilder.WriteString(fmt.Sprintf("tc qdisc add dev eth0 parent 1:%x handle %x: netem %s\n", classID, classID, job.linkProfile(src+1, dst+1).netemArgs(row[dst])))
+		scriptBuilder.WriteString(fmt.Sprintf("tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst %s/32 flowid 1:%x\n", ip, classID))
+	}
+	return scriptBuilder.String()
+}
+
+func (n *holderNetwork) IPs(job Job) []string {
+	IPs := make([]string, job.AddressesCount())
+	for i := range job.AddressesCount() {
+		host := i + 2
+		IPs[i] = fmt.Sprintf("10.%d.%d.%d", n.subnetOctet(job), host/256, host%256)
+	}
+	return IPs
+}
+
+func (n *holderNetwork) ContainerPrefix(job Job) string {
+	return fmt.Sprintf("j%d_", job.ID)
+}
+
+func (n *holderNetwork) ContainerNetworkArgs(job Job, nodeID int) string {
+	return fmt.Sprintf("--network container:%s", n.holderName(job, nodeID))
+}
+
+// Partition drops traffic between the components in the network holders of
+// the nodes, nil partitions heal the network.
+func (n *holderNetwork) Partition(job Job, partitions [][]int) error {
+	rules := map[string][]string{}
+	for _, pair := range crossPartitionPairs(n.IPs(job), partitions) {
+		rules[pair[0]] = append(rules[pair[0]], "-d "+pair[1])
+	}
+
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString("set -e\n\n")
+	for i, ip := range n.IPs(job) {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"docker exec -i %s sh -s <<'EOF'\n%sEOF\n",
+			n.holderName(job, i+1), partitionChainScript(partitionChainName(job), rules[ip]),
+		))
+	}
+
+	var stderr bytes.Buffer
+	if err := n.run(job.Host, scriptBuilder.String(), nil, &stderr); err != nil {
+		return fmt.Errorf("%w\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// TearDown removes the containers and the network of the job. A job without
+// a host never ran, so there is nothing to remove.
+func (n *holderNetwork) TearDown(job Job) error {
+	if job.Host == "" {
+		return nil
+	}
+	fmt.Printf("Removing containers and network of job %s...\n", job.FullName())
+
+	script := "set -e\n\n" + n.teardownScript(job)
+	if err := n.run(job.Host, script, nil, os.Stderr); err != nil {
+		return fmt.Errorf("failed to tear down job %s: %w", job.FullName(), err)
+	}
+	return nil
+}
+
+func (n *holderNetwork) teardownScript(job Job) string {
+	return fmt.Sprintf(`
+docker ps -a -q --filter "name=^%s" | xargs -r docker rm -f >/dev/null
+docker network rm %s >/dev/null 2>&1 || true
+`, n.ContainerPrefix(job), n.networkName(job))
+}
+
+func (n *holderNetwork) networkName(job Job) string {
+	return fmt.Sprintf("hidera_j%d", job.ID)
+}
+
+func (n *holderNetwork) holderName(job Job, nodeID int) string {
+	return fmt.Sprintf("j%d_net_%d", job.ID, nodeID)
+}
+
+func (n *holderNetwork) subnetOctet(job Job) int {
+	return HOLDER_NETWORK_BASE + job.ID%(256-HOLDER_NETWORK_BASE)
+}
+
+func (n *holderNetwork) subnet(job Job) string {
+	return fmt.Sprintf("10.%d.0.0/16", n.subnetOctet(job))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var jitterDistributions = []string{"", "uniform", "normal", "pareto", "paretonormal"}
+
+// LinkProfile holds the netem impairments of a single directed link, on top
+// of the delay taken from the latency matrix.
+type LinkProfile struct {
+	LossPercentage      float64 `json:"loss"`
+	JitterMS            int     `json:"jitter"`
+	JitterDistribution  string  `json:"jitter_distribution"`
+	ReorderPercentage   float64 `json:"reorder"`
+	DuplicatePercentage float64 `json:"duplicate"`
+	CorruptPercentage   float64 `json:"corrupt"`
+	RateKbit            int     `json:"rate_kbit"`
+}
+
+type LinkOverride struct {
+	Src int `json:"src"`
+	Dst int `json:"dst"`
+	LinkProfile
+}
+
+type ResolvedLink struct {
+	Src int `json:"src"`
+	Dst int `json:"dst"`
+	LinkProfile
+}
+
+// NetworkProfile declares the impairments of every link. Links get the
+// default profile, a loss drawn from loss_range if one is given, and finally
+// the override declared for their source/destination pair. Node IDs are 1-based.
+type NetworkProfile struct {
+	Default   LinkProfile    `json:"default"`
+	LossRange []float64      `json:"loss_range"`
+	Links     []LinkOverride `json:"links"`
+	Seed      int64          `json:"seed"`
+}
+
+func isNetworkProfileValid(profile *NetworkProfile, nodesCount int) bool {
+	if profile == nil {
+		return true
+	}
+	if len(profile.LossRange) != 0 && (len(profile.LossRange) != 2 || profile.LossRange[0] > profile.LossRange[1]) {
+		return false
+	}
+	if !profile.Default.isValid() {
+		return false
+	}
+	for _, link := range profile.Links {
+		if link.Src < 1 || link.Src > nodesCount || link.Dst < 1 || link.Dst > nodesCount || !link.isValid() {
+			return false
+		}
+	}
+	return true
+}
+
+func (lp LinkProfile) isValid() bool {
+	for _, percentage := range []float64{lp.LossPercentage, lp.ReorderPercentage, lp.DuplicatePercentage, lp.CorruptPercentage} {
+		if percentage < 0 || percentage > 100 {
+			return false
+		}
+	}
+	return lp.JitterMS >= 0 && lp.RateKbit >= 0 && slices.Contains(jitterDistributions, lp.JitterDistribution)
+}
+
+// Link resolves the profile of the link from src to dst. The random part only
+// depends on the profile seed and the pair, so the result doesn't depend on
+// the order in which links are resolved.
+func (np NetworkProfile) Link(src, dst int) LinkProfile {
+	link := np.Default
+	if len(np.LossRange) == 2 {
+		rng := rand.New(rand.NewSource(pairSeed(np.Seed, src, dst)))
+		loss := np.LossRange[0] + rng.Float64()*(np.LossRange[1]-np.LossRange[0])
+		link.LossPercentage = math.Round(loss*100) / 100
+	}
+	for _, override := range np.Links {
+		if override.Src == src && override.Dst == dst {
+			link = override.LinkProfile
+		}
+	}
+	return link
+}
+
+// ResolvedLinks lists every link whose profile differs from the default.
+func (np NetworkProfile) ResolvedLinks(nodesCount int) []ResolvedLink {
+	links := []ResolvedLink{}
+	for src := 1; src <= nodesCount; src++ {
+		for dst := 1; dst <= nodesCount; dst++ {
+			if src == dst {
+				continue
+			}
+			link := np.Link(src, dst)
+			if link != np.Default {
+				links = append(links, ResolvedLink{Src: src, Dst: dst, LinkProfile: link})
+			}
+		}
+	}
+	return links
+}
+
+func pairSeed(seed int64, src, dst int) int64 {
+	h := fnv.New64a()
+	buf := make([]byte, 24)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(src))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(dst))
+	h.Write(buf)
+	return int64(h.Sum64())
+}
+
+// netemArgs renders the netem options of a link with the given delay.
+func (lp LinkProfile) netemArgs(delayMS int) string {
+	args := []string{fmt.Sprintf("delay %dms", delayMS)}
+	if lp.JitterMS > 0 {
+		args = append(args, fmt.Sprintf("%dms", lp.JitterMS))
+		if lp.JitterDistribution != "" && lp.JitterDistribution != "uniform" {
+			args = append(args, "distribution "+lp.JitterDistribution)
+		}
+	}
+	args = append(args, "loss "+formatPercentage(lp.LossPercentage))
+	if lp.ReorderPercentage > 0 {
+		args = append(args, "reorder "+formatPercentage(lp.ReorderPercentage))
+	}
+	if lp.DuplicatePercentage > 0 {
+		args = append(args, "duplicate "+formatPercentage(lp.DuplicatePercentage))
+	}
+	if lp.CorruptPercentage > 0 {
+		args = append(args, "corrupt "+formatPercentage(lp.CorruptPercentage))
+	}
+	if lp.RateKbit > 0 {
+		args = append(args, fmt.Sprintf("rate %dkbit", lp.RateKbit))
+	}
+	return strings.Join(args, " ")
+}
+
+func formatPercentage(percentage float64) string {
+	return strconv.FormatFloat(percentage, 'f', -1, 64) + "%"
+}
+
+// linkProfile returns the profile of the link between two 1-based node IDs,
+// falling back to the job loss when the plan declares no network profile.
+func (job Job) linkProfile(src, dst int) LinkProfile {
+	if job.NetworkProfile == nil {
+		return LinkProfile{LossPercentage: float64(job.LossPercentage)}
+	}
+	return job.NetworkProfile.Link(src, dst)
+}
+
+// applyNetworkProfile rewrites the netem qdiscs oar-p2p created for every
+// link. oar-p2p classifies traffic with u32 filters matching the source and
+// destination address, so the filters are used to find out which link a
+// qdisc shapes, and the qdisc keeps the delay it was created with. Every link
+// must be rewritten, or the profile metadata.json records wouldn't hold.
+func (job Job) applyNetworkProfile(IPs []string) error {
+	pairs := job.AddressesCount() * (job.AddressesCount() - 1)
+	var table strings.Builder
+	for src := 1; src <= job.AddressesCount(); src++ {
+		for dst := 1; dst <= job.AddressesCount(); dst++ {
+			if src == dst {
+				continue
+			}
+			table.WriteString(fmt.Sprintf(
+				"PROFILES[\"%s %s\"]=\"%s\"\n",
+				IPs[src-1], IPs[dst-1], job.linkProfile(src, dst).netemArgs(0),
+			))
+		}
+	}
+
+	script := fmt.Sprintf(`
+docker run --rm -i --net=host --privileged local/oar-p2p-networking bash -s <<'PROFILE'
+set -e
+declare -A PROFILES
+declare -A APPLIED
+%s
+hex_to_ip() {
+	local h=${1%%%%/*}
+	printf '%%d.%%d.%%d.%%d' 0x${h:0:2} 0x${h:2:2} 0x${h:4:2} 0x${h:6:2}
+}
+for IF in bond0 lo; do
+	declare -A DELAYS=()
+	while read -r line; do
+		if [[ "$line" =~ qdisc[[:space:]]netem[[:space:]]([0-9a-f]+):[[:space:]]parent[[:space:]]([0-9a-f]+:[0-9a-f]+).*delay[[:space:]]([0-9]+)ms ]]; then
+			DELAYS["${BASH_REMATCH[2]}"]="${BASH_REMATCH[1]} ${BASH_REMATCH[3]}"
+		fi
+	done < <(tc qdisc show dev "${IF}")
+	while read -r flowid src dst; do
+		args="${PROFILES["$(hex_to_ip $src) $(hex_to_ip $dst)"]}"
+		qdisc="${DELAYS[$flowid]}"
+		if [[ -z "$args" || -z "$qdisc" ]]; then
+			continue
+		fi
+		read -r handle latency_val <<< "$qdisc"
+		args="${args/delay 0ms/delay ${latency_val}ms}"
+		tc qdisc change dev "${IF}" parent ${flowid} handle ${handle}: netem ${args}
+		APPLIED["$(hex_to_ip $src) $(hex_to_ip $dst)"]=1
+	done < <(tc filter show dev "${IF}" | awk '
+		/flowid/ { for (i = 1; i <= NF; i++) if ($i == "flowid") flowid = $(i + 1); src = ""; dst = "" }
+		/match/ && / at 12/ { src = $2 }
+		/match/ && / at 16/ { dst = $2; if (src != "") print flowid, src, dst }
+	')
+	unset DELAYS
+done
+if [[ ${#APPLIED[@]} -ne %d ]]; then
+	echo "network profile applied to ${#APPLIED[@]} of %d links" >&2
+	exit 1
+fi
+PROFILE
+`, table.String(), pairs, pairs)
+
+	if err := runHostScript(job.Host, script); err != nil {
+		return fmt.Errorf("failed to apply network profile on %s for job %s: %w",
+			job.Host, job.FullName(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PARTITION_RANDOM = "random"
+	PARTITION_CUT    = "cut"
+)
+
+// PartitionEvent splits the network into k components. Components are given
+// explicitly as partitions=1,2,3|4,5 (unlisted nodes form one more component),
+// or chosen with mode=random, which spreads nodes evenly at random, or
+// mode=cut, which grows k connected regions of the overlay around random
+// nodes, so only the edges between regions are cut.
+func PartitionEvent(ctx context.Context, job Job, state *RunState) []EventMetadata {
+	events := []EventMetadata{}
+
+	var partitions [][]int
+	var err error
+	if partitionsStr := job.EventParams["partitions"]; partitionsStr != "" {
+		partitions, err = parsePartitions(partitionsStr, state.NodeIDs())
+	} else {
+		partitions, err = selectPartitions(job, state)
+	}
+	if err != nil {
+		log.Println(err)
+		return events
+	}
+
+	if err := backend.Partition(job, partitions); err != nil {
+		log.Printf("failed to partition network of experiment %s: %v", job.FullName(), err)
+		return events
+	}
+
+	ts := now().UnixNano()
+
+	state.Partition(partitions)
+	events = append(events, state.snapshot(ts))
+
+	return events
+}
+
+func HealEvent(ctx context.Context, job Job, state *RunState) []EventMetadata {
+	events := []EventMetadata{}
+
+	if err := backend.Partition(job, nil); err != nil {
+		log.Printf("failed to heal network of experiment %s: %v", job.FullName(), err)
+		return events
+	}
+
+	ts := now().UnixNano()
+
+	state.Partition(nil)
+	events = append(events, state.snapshot(ts))
+
+	return events
+}
+
+func parsePartitions(partitionsStr string, nodeIDs []int) ([][]int, error) {
+	assigned := map[int]bool{}
+	partitions := [][]int{}
+	for _, partitionStr := range strings.Split(partitionsStr, "|") {
+		partition := []int{}
+		for _, idStr := range strings.Split(partitionStr, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(idStr))
+			if err != nil {
+				return nil, fmt.Errorf("partitions: %w", err)
+			}
+			if assigned[id] {
+				return nil, fmt.Errorf("partitions: node %d listed twice", id)
+			}
+			assigned[id] = true
+			partition = append(partition, id)
+		}
+		sort.Ints(partition)
+		partitions = append(partitions, partition)
+	}
+
+	rest := []int{}
+	for _, id := range nodeIDs {
+		if !assigned[id] {
+			rest = append(rest, id)
+		}
+	}
+	if len(rest) > 0 {
+		partitions = append(partitions, rest)
+	}
+	return partitions, nil
+}
+
+func selectPartitions(job Job, state *RunState) ([][]int, error) {
+	k, err := intEventParam(job, "k", 2)
+	if err != nil {
+		return nil, err
+	}
+	nodeIDs := state.NodeIDs()
+	if k < 2 || k > len(nodeIDs) {
+		return nil, fmt.Errorf("partitions: can't split %d nodes into %d components", len(nodeIDs), k)
+	}
+
+	rng := rand.New(rand.NewSource(job.Seed + int64(state.Repetition)))
+	var partitions [][]int
+	switch mode := job.EventParams["mode"]; mode {
+	case "", PARTITION_RANDOM:
+		partitions = randomPartitions(nodeIDs, k, rng)
+	case PARTITION_CUT:
+		graph := state.Graph()
+		partitions = cutPartitions(graph.undirected(), k, rng)
+	default:
+		return nil, fmt.Errorf("unknown partition mode %s", mode)
+	}
+
+	for _, partition := range partitions {
+		sort.Ints(partition)
+	}
+	return partitions, nil
+}
+
+func randomPartitions(nodeIDs []int, k int, rng *rand.Rand) [][]int {
+	partitions := make([][]int, k)
+	for i, idx := range rng.Perm(len(nodeIDs)) {
+		partitions[i%k] = append(partitions[i%k], nodeIDs[idx])
+	}
+	return partitions
+}
+
+// cutPartitions grows the regions breadth first from k random seeds, one
+// node per region in turn, so regions end up connected and similar in size.
+// Nodes unreachable from every seed join the smallest region.
+func cutPartitions(g *Graph, k int, rng *rand.Rand) [][]int {
+	n := len(g.Adj)
+	region := make([]int, n)
+	for u := range region {
+		region[u] = -1
+	}
+
+	partitions := make([][]int, k)
+	queues := make([][]int, k)
+	for i, u := range rng.Perm(n)[:k] {
+		region[u] = i
+		partitions[i] = append(partitions[i], u+1)
+		queues[i] = append(queues[i], u)
+	}
+
+	for grown := true; grown; {
+		grown = false
+		for i := range k {
+			for len(queues[i]) > 0 {
+				u := queues[i][0]
+				claimed := false
+				for _, v := range g.Adj[u] {
+					if region[v] < 0 {
+						region[v] = i
+						partitions[i] = append(partitions[i], v+1)
+						queues[i] = append(queues[i], v)
+						claimed = true
+						break
+					}
+				}
+				if claimed {
+					grown = true
+					break
+				}
+				queues[i] = queues[i][1:]
+			}
+		}
+	}
+
+	for u := range n {
+		if region[u] >= 0 {
+			continue
+		}
+		smallest := 0
+		for i := range k {
+			if len(partitions[i]) < len(partitions[smallest]) {
+				smallest = i
+			}
+		}
+		partitions[smallest] = append(partitions[smallest], u+1)
+	}
+	return partitions
+}
+
+// crossPartitionPairs lists the IPs of every ordered pair of nodes that sit
+// in different components.
+func crossPartitionPairs(IPs []string, partitions [][]int) [][2]string {
+	pairs := [][2]string{}
+	for i, src := range partitions {
+		for j, dst := range partitions {
+			if i == j {
+				continue
+			}
+			for _, srcID := range src {
+				for _, dstID := range dst {
+					pairs = append(pairs, [2]string{IPs[srcID-1], IPs[dstID-1]})
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// partitionChainScript resets the iptables chain that drops traffic between
+// components and fills it with rules, one per line of arguments. Without
+// rules the chain is removed, which heals the network.
+func partitionChainScript(chain string, rules []string) string {
+	scriptBuilder := strings.Builder{}
+	scriptBuilder.WriteString(fmt.Sprintf("iptables -D OUTPUT -j %s 2>/dev/null || true\n", chain))
+	scriptBuilder.WriteString(fmt.Sprintf("iptables -F %s 2>/dev/null || true\n", chain))
+	scriptBuilder.WriteString(fmt.Sprintf("iptables -X %s 2>/dev/null || true\n", chain))
+	if len(rules) == 0 {
+		return scriptBuilder.String()
+	}
+	scriptBuilder.WriteString(fmt.Sprintf("iptables -N %s\n", chain))
+	for _, rule := range rules {
+		scriptBuilder.WriteString(fmt.Sprintf("iptables -A %s %s -j DROP\n", chain, rule))
+	}
+	scriptBuilder.WriteString(fmt.Sprintf("iptables -I OUTPUT -j %s\n", chain))
+	return scriptBuilder.String()
+}
+
+func partitionChainName(job Job) string {
+	return fmt.Sprintf("HIDERA_PARTITION_%d", job.ID)
+}
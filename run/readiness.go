@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	READINESS_HTTP   = "http"
+	READINESS_DOCKER = "docker"
+
+	READINESS_INTERVAL          = time.Second
+	DEFAULT_READINESS_TIMEOUT_S = 120
+)
+
+// readinessFns render a script that prints "<id> ready" for every node that
+// passes the probe.
+var readinessFns = map[string]func(job Job, nodeIDs []int) string{
+	READINESS_HTTP:   httpReadinessScript,
+	READINESS_DOCKER: dockerReadinessScript,
+}
+
+func isReadinessProbeValid(probe string) bool {
+	_, ok := readinessFns[probe]
+	return ok || probe == ""
+}
+
+func httpReadinessScript(job Job, nodeIDs []int) string {
+	IPs := backend.IPs(job)
+
+	scriptBuilder := strings.Builder{}
+	for _, id := range nodeIDs {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"curl -sf -o /dev/null --max-time 1 http://%s:%d/metrics && echo \"%d ready\" || true\n",
+			IPs[id-1], protocolSpec(job.Protocol).MetricsPort, id,
+		))
+	}
+	return scriptBuilder.String()
+}
+
+// dockerReadinessScript relies on the image health check, containers of
+// images without one are ready once they are running.
+func dockerReadinessScript(job Job, nodeIDs []int) string {
+	scriptBuilder := strings.Builder{}
+	for _, id := range nodeIDs {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"status=$(docker inspect --format '{{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}' %s 2>/dev/null || true)\n",
+			containerName(job, id),
+		))
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"[ \"$status\" = healthy ] || [ \"$status\" = running ] && echo \"%d ready\" || true\n",
+			id,
+		))
+	}
+	return scriptBuilder.String()
+}
+
+// convergenceScript prints "<id> <value>" with the latest output of every
+// node, taken from the value file it logs.
+func convergenceScript(job Job, nodeIDs []int, repetition int) string {
+	scriptBuilder := strings.Builder{}
+	for _, id := range nodeIDs {
+		scriptBuilder.WriteString(fmt.Sprintf(
+			"echo \"%d $(tail -n 1 %s/%s/exp_%d/%s/value.csv 2>/dev/null | cut -d, -f4)\"\n",
+			id, backend.ExperimentsDir(), job.FullName(), repetition, nodeName(id),
+		))
+	}
+	return scriptBuilder.String()
+}
+
+// waitReady polls live nodes until all of them pass the plan's readiness
+// probe and, if the plan sets readiness_epsilon, their output is within
+// epsilon of the expected value.
+func waitReady(ctx context.Context, job Job, state *RunState) error {
+	timeoutS := job.ReadyTimeoutS
+	if timeoutS <= 0 {
+		timeoutS = DEFAULT_READINESS_TIMEOUT_S
+	}
+
+	deadline := now().Add(time.Duration(timeoutS) * time.Second)
+	probe := readinessFns[job.ReadyProbe]
+
+	for {
+		nodeIDs := state.Alive()
+		ready, err := probeNodes(job, probe(job, nodeIDs))
+		if err != nil {
+			return err
+		}
+		if dryRun != nil {
+			// nodes don't answer in a dry run, one probe is enough to render
+			return nil
+		}
+		pending := len(nodeIDs) - len(ready)
+
+		if pending == 0 && job.ReadyEpsilon > 0 {
+			outputs, err := probeNodes(job, convergenceScript(job, nodeIDs, state.Repetition))
+			if err != nil {
+				return err
+			}
+			expected := state.Expected()
+			for _, id := range nodeIDs {
+				value, err := strconv.ParseFloat(outputs[id], 64)
+				if err != nil || math.Abs(value-expected) > job.ReadyEpsilon {
+					pending++
+				}
+			}
+		}
+
+		if pending == 0 {
+			return nil
+		}
+		if now().After(deadline) {
+			return fmt.Errorf("%d nodes of experiment %s not ready after %ds", pending, job.FullName(), timeoutS)
+		}
+		if !sleepCtx(ctx, READINESS_INTERVAL) {
+			return ctx.Err()
+		}
+	}
+}
+
+func probeNodes(job Job, script string) (map[int]string, error) {
+	var stdout, stderr bytes.Buffer
+	if err := backend.RunScript(job.Host, script, &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("failed to probe nodes of experiment %s: %w\n%s", job.FullName(), err, stderr.String())
+	}
+
+	results := map[int]string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		results[id] = fields[1]
+	}
+	return results, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tamararankovic/hidera_eval/configfile"
+)
+
+const DEFAULT_PROTOCOLS_FILE = configfile.DEFAULT_PROTOCOLS_FILE
+
+// ProtocolSpec is the entry of a protocol in the registry file, which analyze
+// and plot read as well. Relative params paths are relative to the registry.
+type ProtocolSpec struct {
+	Code         Protocol `json:"code"`
+	Image        string   `json:"image"`
+	BuildContext string   `json:"build_context"`
+	ListenPort   int      `json:"listen_port"`
+	MetricsPort  int      `json:"metrics_port"`
+	Params       string   `json:"params"`
+	Color        string   `json:"color"`
+}
+
+// protocolRegistry lists the protocols in the order of the registry file,
+// protocolRegistryFile is the file as read.
+var (
+	protocolRegistry     []ProtocolSpec
+	protocolRegistryFile []byte
+)
+
+func loadProtocolRegistry(path string) error {
+	path, err := configfile.Find(path, DEFAULT_PROTOCOLS_FILE)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("protocol registry %s not found", DEFAULT_PROTOCOLS_FILE)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	specs := []ProtocolSpec{}
+	if err := json.Unmarshal(content, &specs); err != nil {
+		return fmt.Errorf("protocol registry %s: %w", path, err)
+	}
+
+	seen := map[Protocol]bool{}
+	for i, spec := range specs {
+		if spec.Code == "" || spec.Code == PROTOCOL_ALL || seen[spec.Code] {
+			return fmt.Errorf("protocol registry %s: invalid or duplicate code %q", path, spec.Code)
+		}
+		if spec.Image == "" || spec.BuildContext == "" || spec.ListenPort <= 0 || spec.MetricsPort <= 0 {
+			return fmt.Errorf("protocol registry %s: protocol %s needs image, build_context, listen_port and metrics_port", path, spec.Code)
+		}
+		if spec.Params != "" && !filepath.IsAbs(spec.Params) {
+			specs[i].Params = filepath.Join(filepath.Dir(path), spec.Params)
+		}
+		seen[spec.Code] = true
+	}
+
+	protocolRegistry = specs
+	protocolRegistryFile = content
+	return nil
+}
+
+func registeredProtocols() []Protocol {
+	protocols := []Protocol{}
+	for _, spec := range protocolRegistry {
+		protocols = append(protocols, spec.Code)
+	}
+	return protocols
+}
+
+func protocolSpec(protocol Protocol) ProtocolSpec {
+	for _, spec := range protocolRegistry {
+		if spec.Code == protocol {
+			return spec
+		}
+	}
+	return ProtocolSpec{}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	SSH_DIAL_TIMEOUT       = 30 * time.Second
+	SSH_KEEPALIVE_INTERVAL = 30 * time.Second
+)
+
+// Remote runs scripts on, and copies files to and from, the cluster
+// frontend and the hosts of jobs.
+type Remote interface {
+	// Run feeds script to bash on host.
+	Run(host, script string, stdout, stderr io.Writer) error
+	// Upload writes content to path on host, creating missing directories.
+	Upload(host, path string, content []byte) error
+	// Download copies the directory remoteDir of host into localDir.
+	Download(host, remoteDir, localDir string) error
+}
+
+// RemoteError is a script that failed on a host, with what it printed to
+// stderr.
+type RemoteError struct {
+	Host       string
+	ExitStatus int
+	Stderr     string
+	Err        error
+}
+
+func (e *RemoteError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", e.Host, e.Err)
+	}
+	return fmt.Sprintf("%s: %v\n%s", e.Host, e.Err, e.Stderr)
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// runRemoteCmd runs remoteCmd on host and returns its stdout.
+func runRemoteCmd(remote Remote, host, remoteCmd string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := remote.Run(host, remoteCmd, &stdout, &stderr)
+	if err != nil {
+		remoteErr := &RemoteError{Host: host, ExitStatus: -1, Stderr: stderr.String(), Err: err}
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			remoteErr.ExitStatus = exitErr.ExitStatus()
+		}
+		return stdout.String(), remoteErr
+	}
+	return stdout.String(), nil
+}
+
+// remoteCmdRunner runs scheduler commands on the frontend.
+func remoteCmdRunner(remote Remote) cmdRunner {
+	return func(remoteCmd string) (string, error) {
+		return runRemoteCmd(remote, config.Frontend, remoteCmd)
+	}
+}
+
+// sshRemote keeps one connection per host and opens a session on it for
+// every script. Hosts are looked up in ~/.ssh/config, and hosts without a
+// ProxyJump of their own are reached through the frontend. Only the keys of
+// job hosts reached through a jump host are pinned on first use. Pooled
+// connections are kept alive, and dropped once the host stops answering.
+type sshRemote struct {
+	frontend          string
+	hostKeys          *hostKeys
+	keepAliveInterval time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+func newSSHRemote(frontend string) (*sshRemote, error) {
+	hostKeys, err := loadHostKeys(filepath.Join(sshDir(), "known_hosts"))
+	if err != nil {
+		return nil, err
+	}
+	return &sshRemote{
+		frontend:          frontend,
+		hostKeys:          hostKeys,
+		keepAliveInterval: SSH_KEEPALIVE_INTERVAL,
+		clients:           map[string]*ssh.Client{},
+	}, nil
+}
+
+func (r *sshRemote) Run(host, script string, stdout, stderr io.Writer) error {
+	session, err := r.session(host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = strings.NewReader(script)
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run("bash -s")
+}
+
+func (r *sshRemote) Upload(host, filePath string, content []byte) error {
+	session, err := r.session(host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(content)
+	session.Stderr = &stderr
+	remoteCmd := fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(path.Dir(filePath)), shellQuote(filePath))
+	if err := session.Run(remoteCmd); err != nil {
+		return &RemoteError{Host: host, Stderr: stderr.String(), Err: fmt.Errorf("upload %s: %w", filePath, err)}
+	}
+	return nil
+}
+
+// Download streams the directory as a tar archive and unpacks it, so
+// localDir/<base of remoteDir> mirrors it the way scp -r would.
+func (r *sshRemote) Download(host, remoteDir, localDir string) error {
+	session, err := r.session(host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	archive, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	remoteCmd := fmt.Sprintf("tar -C %s -cf - %s", shellQuote(path.Dir(remoteDir)), shellQuote(path.Base(remoteDir)))
+	if err := session.Start(remoteCmd); err != nil {
+		return err
+	}
+
+	untarErr := untar(archive, localDir)
+	if err := session.Wait(); err != nil {
+		return &RemoteError{Host: host, Stderr: stderr.String(), Err: fmt.Errorf("download %s: %w", remoteDir, err)}
+	}
+	return untarErr
+}
+
+func untar(archive io.Reader, dir string) error {
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("unexpected path %s in archive", header.Name)
+		}
+		target := filepath.Join(dir, header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, reader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// session opens a session to host, dialing again once if the pooled
+// connection turns out to be closed.
+func (r *sshRemote) session(host string) (*ssh.Session, error) {
+	defaultJump := r.frontend
+	if host == r.frontend {
+		defaultJump = ""
+	}
+
+	jobHost := host != r.frontend
+	client, err := r.client(host, defaultJump, jobHost)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	r.drop(host, client)
+	client, err = r.client(host, defaultJump, jobHost)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+// client returns the pooled connection to host, which is dialed through
+// defaultJump unless the ssh config names a ProxyJump for host. The frontend
+// and jump hosts aren't job hosts and have to be in known_hosts.
+func (r *sshRemote) client(host, defaultJump string, jobHost bool) (*ssh.Client, error) {
+	r.mu.Lock()
+	client, ok := r.clients[host]
+	r.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	client, err := r.dial(host, defaultJump, jobHost)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: %w", host, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pooled, ok := r.clients[host]; ok {
+		client.Close()
+		return pooled, nil
+	}
+	r.clients[host] = client
+	go r.keepAlive(host, client)
+	return client, nil
+}
+
+// keepAlive sends a keepalive request over client every keepAliveInterval
+// and drops the client once a request fails or goes unanswered for an
+// interval, so the next session dials again instead of hanging on a dead
+// connection.
+func (r *sshRemote) keepAlive(host string, client *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(r.keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			// servers that don't know the request still answer it
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+		select {
+		case err := <-replied:
+			if err == nil {
+				continue
+			}
+		case <-time.After(r.keepAliveInterval):
+		case <-closed:
+			return
+		}
+		log.Printf("ssh %s: connection lost\n", host)
+		r.drop(host, client)
+		return
+	}
+}
+
+func (r *sshRemote) drop(host string, client *ssh.Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[host] == client {
+		delete(r.clients, host)
+	}
+	client.Close()
+}
+
+func (r *sshRemote) dial(host, defaultJump string, jobHost bool) (*ssh.Client, error) {
+	hostConfig := loadSSHHostConfig(host)
+	if hostConfig.User == "" && host != r.frontend {
+		hostConfig.User = loadSSHHostConfig(r.frontend).User
+	}
+	if hostConfig.User == "" {
+		if current, err := user.Current(); err == nil {
+			hostConfig.User = current.Username
+		}
+	}
+	jump := cmp.Or(hostConfig.ProxyJump, defaultJump)
+	pinUnknown := jobHost && jump != "" && jump != "none"
+
+	// the agent is only asked for signatures while authenticating
+	auth, closeAgent := sshAuthMethods(hostConfig.IdentityFiles)
+	defer closeAgent()
+	checkHostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return r.hostKeys.check(hostname, remote, key, pinUnknown)
+	}
+	config := &ssh.ClientConfig{
+		User:            hostConfig.User,
+		Auth:            auth,
+		HostKeyCallback: checkHostKey,
+		Timeout:         SSH_DIAL_TIMEOUT,
+	}
+	addr := net.JoinHostPort(hostConfig.HostName, hostConfig.Port)
+
+	if jump == "" || jump == "none" {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	// the last hop of a chain is dialed through the ones before it
+	hops := strings.Split(jump, ",")
+	jumpClient, err := r.client(hops[len(hops)-1], strings.Join(hops[:len(hops)-1], ","), false)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := jumpClient.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// sshAuthMethods returns the keys of ssh-agent and of the identity files,
+// and a func that closes the connection to the agent.
+func sshAuthMethods(identityFiles []string) ([]ssh.AuthMethod, func()) {
+	methods := []ssh.AuthMethod{}
+	closeAgent := func() {}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	if len(identityFiles) == 0 {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			identityFiles = append(identityFiles, filepath.Join(sshDir(), name))
+		}
+	}
+	signers := []ssh.Signer{}
+	for _, identityFile := range identityFiles {
+		key, err := os.ReadFile(identityFile)
+		if err != nil {
+			continue
+		}
+		// keys with a passphrase are only used through the agent
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, closeAgent
+}
+
+// hostKeys checks host keys against known_hosts. Reserved nodes change from
+// job to job, so job hosts missing from it may be accepted, and the first key
+// they present is then pinned for the rest of the run.
+type hostKeys struct {
+	path  string
+	known ssh.HostKeyCallback
+
+	mu     sync.Mutex
+	pinned map[string]ssh.PublicKey
+}
+
+// loadHostKeys reads the known_hosts file at path. Without one, every host
+// counts as missing from it.
+func loadHostKeys(path string) (*hostKeys, error) {
+	keys := &hostKeys{path: path, pinned: map[string]ssh.PublicKey{}}
+	known, err := knownhosts.New(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("known hosts: %w", err)
+	}
+	keys.known = known
+	return keys, nil
+}
+
+// check accepts key if known_hosts has it for hostname. A host missing from
+// known_hosts is rejected, unless pinUnknown is set and key is the first, or
+// the pinned, key it presents.
+func (k *hostKeys) check(hostname string, remote net.Addr, key ssh.PublicKey, pinUnknown bool) error {
+	if k.known != nil {
+		err := k.known(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+	}
+
+	host := knownhosts.Normalize(hostname)
+	if !pinUnknown {
+		return fmt.Errorf("host %s is not in %s, connect to it with ssh once to add its %s key", host, k.path, key.Type())
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	pinned, ok := k.pinned[host]
+	if !ok {
+		log.Printf("Host %s is not known, pinning its %s key for this run\n", host, key.Type())
+		k.pinned[host] = key
+		return nil
+	}
+	if !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+		return fmt.Errorf("host key of %s changed during the run", host)
+	}
+	return nil
+}
+
+func sshDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ssh"
+	}
+	return filepath.Join(home, ".ssh")
+}
+
+// sshHostConfig holds the few ~/.ssh/config options the runner honours.
+type sshHostConfig struct {
+	HostName      string
+	User          string
+	Port          string
+	ProxyJump     string
+	IdentityFiles []string
+}
+
+// loadSSHHostConfig resolves host the way ssh does for these options: the
+// first value given in a matching Host block wins.
+func loadSSHHostConfig(host string) sshHostConfig {
+	hostConfig := sshHostConfig{}
+
+	file, err := os.Open(filepath.Join(sshDir(), "config"))
+	if err == nil {
+		defer file.Close()
+
+		matching := true
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, _ := strings.Cut(strings.Replace(line, "=", " ", 1), " ")
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+
+			switch strings.ToLower(key) {
+			case "host":
+				matching = sshHostMatches(host, strings.Fields(value))
+			case "match":
+				matching = false
+			}
+			if !matching {
+				continue
+			}
+
+			switch strings.ToLower(key) {
+			case "hostname":
+				hostConfig.HostName = cmp.Or(hostConfig.HostName, value)
+			case "user":
+				hostConfig.User = cmp.Or(hostConfig.User, value)
+			case "port":
+				hostConfig.Port = cmp.Or(hostConfig.Port, value)
+			case "proxyjump":
+				hostConfig.ProxyJump = cmp.Or(hostConfig.ProxyJump, value)
+			case "identityfile":
+				if strings.HasPrefix(value, "~/") {
+					value = filepath.Join(filepath.Dir(sshDir()), value[2:])
+				}
+				hostConfig.IdentityFiles = append(hostConfig.IdentityFiles, value)
+			}
+		}
+	}
+
+	if hostConfig.HostName == "" {
+		hostConfig.HostName = host
+	}
+	hostConfig.HostName = strings.ReplaceAll(hostConfig.HostName, "%h", host)
+	if hostConfig.Port == "" {
+		hostConfig.Port = "22"
+	}
+	return hostConfig
+}
+
+func sshHostMatches(host string, patterns []string) bool {
+	matches := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), host)
+		if ok && negated {
+			return false
+		}
+		matches = matches || ok
+	}
+	return matches
+}
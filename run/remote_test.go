@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// fakeRemote records what is run on and copied to and from every host.
+// Scripts on the hosts in failing print to stderr and fail.
+type fakeRemote struct {
+	scripts   []string
+	uploads   map[string]string
+	downloads []string
+	failing   map[string]error
+}
+
+func (r *fakeRemote) Run(host, script string, stdout, stderr io.Writer) error {
+	r.scripts = append(r.scripts, host+": "+script)
+	if err, ok := r.failing[host]; ok {
+		io.WriteString(stderr, "no space left on device\n")
+		return err
+	}
+	if stdout != nil {
+		io.WriteString(stdout, "ok\n")
+	}
+	return nil
+}
+
+func (r *fakeRemote) Upload(host, path string, content []byte) error {
+	r.uploads[host+":"+path] = string(content)
+	return nil
+}
+
+func (r *fakeRemote) Download(host, remoteDir, localDir string) error {
+	r.downloads = append(r.downloads, host+":"+remoteDir+" "+localDir)
+	return nil
+}
+
+func TestClusterBackendUsesRemote(t *testing.T) {
+	failed := errors.New("Process exited with status 1")
+	remote := &fakeRemote{uploads: map[string]string{}, failing: map[string]error{"node-2": failed}}
+	b := newClusterBackend(&fakeScheduler{}, &oarP2PNetwork{}, remote, "moltres", "/exp", "/src", "/tools")
+
+	if err := b.WriteFile("node-1", "/exp/dummy_hi/.env", []byte("ROUNDS=10\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := remote.uploads["node-1:/exp/dummy_hi/.env"]; got != "ROUNDS=10\n" {
+		t.Errorf("uploads = %v", remote.uploads)
+	}
+
+	if err := b.Export(Job{JobPlan: JobPlan{ExperimanetName: "dummy"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := config.Frontend + ":/exp/dummy_plots ../export/"; len(remote.downloads) != 1 || remote.downloads[0] != want {
+		t.Errorf("downloads = %v, want %s", remote.downloads, want)
+	}
+
+	out, err := runRemoteCmd(remote, "node-1", "docker ps -q")
+	if err != nil || out != "ok\n" {
+		t.Errorf("runRemoteCmd = %q, %v", out, err)
+	}
+
+	_, err = runRemoteCmd(remote, "node-2", "docker ps -q")
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("runRemoteCmd error %v is no RemoteError", err)
+	}
+	if remoteErr.Host != "node-2" || remoteErr.Stderr != "no space left on device\n" || !errors.Is(err, failed) {
+		t.Errorf("RemoteError = %+v", remoteErr)
+	}
+	if !strings.Contains(err.Error(), "no space left on device") {
+		t.Errorf("error %q doesn't say what the script printed", err)
+	}
+}
+
+func newTestHostKey(t *testing.T) ssh.Signer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestHostKeysPinOnlyUnknownJobHosts(t *testing.T) {
+	frontendKey := newTestHostKey(t).PublicKey()
+	nodeKey := newTestHostKey(t).PublicKey()
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(knownhosts.Line([]string{"nova_cluster"}, frontendKey)+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadHostKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keys.check("nova_cluster:22", addr, frontendKey, false); err != nil {
+		t.Errorf("known key rejected: %v", err)
+	}
+	if err := keys.check("nova_cluster:22", addr, nodeKey, true); err == nil {
+		t.Error("changed key of a known host accepted")
+	}
+	if err := keys.check("jump:22", addr, nodeKey, false); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("unknown host that may not be pinned: %v, want an error naming %s", err, path)
+	}
+	if err := keys.check("node-1:22", addr, nodeKey, true); err != nil {
+		t.Errorf("unknown job host rejected: %v", err)
+	}
+	if err := keys.check("node-1:22", addr, nodeKey, true); err != nil {
+		t.Errorf("pinned key rejected: %v", err)
+	}
+	if err := keys.check("node-1:22", addr, frontendKey, true); err == nil {
+		t.Error("key other than the pinned one accepted")
+	}
+
+	keys, err = loadHostKeys(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatalf("missing known_hosts: %v", err)
+	}
+	if err := keys.check("nova_cluster:22", addr, frontendKey, false); err == nil {
+		t.Error("frontend accepted without known_hosts")
+	}
+	if err := keys.check("node-1:22", addr, nodeKey, true); err != nil {
+		t.Errorf("unknown job host rejected without known_hosts: %v", err)
+	}
+	if err := keys.check("node-1:22", addr, frontendKey, true); err == nil {
+		t.Error("key other than the pinned one accepted without known_hosts")
+	}
+
+	if err := os.WriteFile(path, []byte("nova_cluster ssh-ed25519 not-a-key\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHostKeys(path); err == nil {
+		t.Error("unreadable known_hosts accepted")
+	}
+}
+
+func TestSSHRemoteRejectsUnknownFrontend(t *testing.T) {
+	addr, _ := serveSSH(t, 0)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	sshConfig := "Host frontend\n\tHostName " + host + "\n\tPort " + port + "\n"
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(sshConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newSSHRemote("frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Run("frontend", "true", io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "known_hosts") {
+		t.Errorf("frontend missing from known_hosts: %v, want a known_hosts error", err)
+	}
+	if len(r.hostKeys.pinned) != 0 {
+		t.Errorf("pinned %v", r.hostKeys.pinned)
+	}
+}
+
+// serveSSH accepts a single connection and answers the first answered
+// global requests, leaving the ones after them unanswered like a host that
+// went away would.
+func serveSSH(t *testing.T, answered int) (string, func() int) {
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(newTestHostKey(t))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	requests := 0
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		serverConn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { serverConn.Close() })
+		go func() {
+			for newChannel := range chans {
+				newChannel.Reject(ssh.Prohibited, "no sessions")
+			}
+		}()
+		for req := range reqs {
+			mu.Lock()
+			requests++
+			if requests <= answered {
+				req.Reply(false, nil)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return listener.Addr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestKeepAliveDropsUnansweredConnection(t *testing.T) {
+	addr, requests := serveSSH(t, 2)
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "hidera",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         SSH_DIAL_TIMEOUT,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &sshRemote{keepAliveInterval: 20 * time.Millisecond, clients: map[string]*ssh.Client{"node-1": client}}
+	go r.keepAlive("node-1", client)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		r.mu.Lock()
+		_, pooled := r.clients["node-1"]
+		r.mu.Unlock()
+		if !pooled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unanswered connection is still pooled")
+		}
+	}
+	if n := requests(); n != 3 {
+		t.Errorf("%d keepalive requests, want 2 answered and 1 unanswered", n)
+	}
+	if err := client.Wait(); err == nil {
+		t.Error("dropped client was not closed")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SCHEDULER_OAR   = "oar"
+	SCHEDULER_SLURM = "slurm"
+)
+
+// Scheduler reserves cluster nodes for jobs. Implementations only build
+// commands and parse their output, the commands themselves are executed by
+// the runner, so a fake runner returning canned output can stand in for the
+// frontend.
+type Scheduler interface {
+	Submit(name, cluster string) (int, error)
+	// States returns the state of each of the jobs the scheduler still
+	// knows, with a single command however many jobs there are.
+	States(jobIDs []int) (map[int]string, error)
+	Host(jobID int) (string, error)
+	Cancel(jobID int) error
+}
+
+type cmdRunner func(remoteCmd string) (string, error)
+
+// newScheduler returns a scheduler reserving nodes for walltime, jobs hold
+// their node by sleeping for the whole walltime.
+func newScheduler(name string, run cmdRunner, walltime time.Duration) (Scheduler, error) {
+	switch name {
+	case SCHEDULER_OAR:
+		return &oarScheduler{run: run, walltime: walltime}, nil
+	case SCHEDULER_SLURM:
+		return &slurmScheduler{run: run, walltime: walltime}, nil
+	}
+	return nil, fmt.Errorf("unknown scheduler %s", name)
+}
+
+type oarScheduler struct {
+	run      cmdRunner
+	walltime time.Duration
+}
+
+func (s *oarScheduler) Submit(name, cluster string) (int, error) {
+	remoteCmd := fmt.Sprintf(`
+	export LC_ALL=C LANG=C
+	oarsub -l "{cluster='%s'}/nodes=1,walltime=%d:%02d" \
+		--project %s 'sleep %d'
+	`, cluster, int(s.walltime.Hours()), int(s.walltime.Minutes())%60, name, int(s.walltime.Seconds()))
+
+	out, err := s.run(remoteCmd)
+	if err != nil {
+		return -1, err
+	}
+
+	return extractJobID(out)
+}
+
+func (s *oarScheduler) States(jobIDs []int) (map[int]string, error) {
+	remoteCmd := `
+	export LC_ALL=C LANG=C
+	oarstat -u $USER
+	`
+
+	out, err := s.run(remoteCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[int]string{}
+	for _, jobID := range jobIDs {
+		if state, err := extractJobState(out, jobID); err == nil {
+			states[jobID] = state
+		}
+	}
+	return states, nil
+}
+
+func (s *oarScheduler) Host(jobID int) (string, error) {
+	remoteCmd := fmt.Sprintf(`
+	export LC_ALL=C LANG=C
+	oarstat -J -fj %d
+	`, jobID)
+
+	out, err := s.run(remoteCmd)
+	if err != nil {
+		return "", err
+	}
+
+	return extractHost(out)
+}
+
+func (s *oarScheduler) Cancel(jobID int) error {
+	_, err := s.run(fmt.Sprintf("oardel %d", jobID))
+	return err
+}
+
+type slurmScheduler struct {
+	run      cmdRunner
+	walltime time.Duration
+}
+
+func (s *slurmScheduler) Submit(name, cluster string) (int, error) {
+	remoteCmd := fmt.Sprintf(`
+	export LC_ALL=C LANG=C
+	sbatch --parsable --partition=%s --job-name=%s \
+		--nodes=1 --time=%d:%02d:%02d --wrap 'sleep %d'
+	`, cluster, name, int(s.walltime.Hours()), int(s.walltime.Minutes())%60, int(s.walltime.Seconds())%60, int(s.walltime.Seconds()))
+
+	out, err := s.run(remoteCmd)
+	if err != nil {
+		return -1, err
+	}
+
+	return extractSlurmJobID(out)
+}
+
+func (s *slurmScheduler) States(jobIDs []int) (map[int]string, error) {
+	ids := []string{}
+	for _, jobID := range jobIDs {
+		ids = append(ids, strconv.Itoa(jobID))
+	}
+	out, err := s.run(fmt.Sprintf("squeue -h -j %s -o '%%i %%t'", strings.Join(ids, ",")))
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[int]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		jobID, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		states[jobID] = fields[1]
+	}
+	return states, nil
+}
+
+func (s *slurmScheduler) Host(jobID int) (string, error) {
+	out, err := s.run(fmt.Sprintf("squeue -h -j %d -o %%N", jobID))
+	if err != nil {
+		return "", err
+	}
+
+	// the node list stays empty while the job is pending
+	host := strings.TrimSpace(out)
+	if host == "" {
+		return "", errors.New("node list not found")
+	}
+	return host, nil
+}
+
+func (s *slurmScheduler) Cancel(jobID int) error {
+	_, err := s.run(fmt.Sprintf("scancel %d", jobID))
+	return err
+}
+
+func extractSlurmJobID(out string) (int, error) {
+	// --parsable prints "<job_id>" or "<job_id>;<cluster>"
+	fields := strings.Split(strings.TrimSpace(out), ";")
+	jobID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return -1, fmt.Errorf("no job id found: %w", err)
+	}
+	return jobID, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFrontend answers scheduler commands with canned output and records
+// every command it is asked to run.
+type fakeFrontend struct {
+	cmds    []string
+	outputs map[string]string
+}
+
+func (f *fakeFrontend) run(remoteCmd string) (string, error) {
+	f.cmds = append(f.cmds, remoteCmd)
+	for prefix, out := range f.outputs {
+		if strings.Contains(remoteCmd, prefix) {
+			return out, nil
+		}
+	}
+	return "", errors.New("unexpected command: " + remoteCmd)
+}
+
+func TestOARScheduler(t *testing.T) {
+	frontend := &fakeFrontend{outputs: map[string]string{
+		"oarsub": "[ADMISSION RULE] Set default walltime\nOAR_JOB_ID=4242\n",
+		"oarstat -u": "Job id     S User     Duration   System message\n" +
+			"---------- - -------- ---------- ------------------------------\n" +
+			"4242       R tamara      0:01:02 R=1,W=12:0:0\n" +
+			"4243       W tamara      0:00:00 R=1,W=12:0:0\n",
+		"oarstat -J -fj 4242": "{\n \"4242\" : {\n  \"assigned_network_address\" : [\n   \"node-7.cluster\"\n  ]\n }\n}\n",
+		"oardel 4242":         "",
+	}}
+	scheduler, err := newScheduler(SCHEDULER_OAR, frontend.run, 90*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobID, err := scheduler.Submit("exp_hi", "moltres")
+	if err != nil || jobID != 4242 {
+		t.Fatalf("Submit = %d, %v", jobID, err)
+	}
+	if !strings.Contains(frontend.cmds[0], "walltime=1:30") || !strings.Contains(frontend.cmds[0], "cluster='moltres'") {
+		t.Errorf("oarsub command: %s", frontend.cmds[0])
+	}
+
+	states, err := scheduler.States([]int{4242, 4243, 4244})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[4242] != "R" || states[4243] != "W" {
+		t.Errorf("States = %v", states)
+	}
+
+	host, err := scheduler.Host(4242)
+	if err != nil || host != "node-7.cluster" {
+		t.Errorf("Host = %q, %v", host, err)
+	}
+
+	if err := scheduler.Cancel(4242); err != nil {
+		t.Error(err)
+	}
+	if last := frontend.cmds[len(frontend.cmds)-1]; last != "oardel 4242" {
+		t.Errorf("Cancel ran %q", last)
+	}
+}
+
+func TestSlurmScheduler(t *testing.T) {
+	frontend := &fakeFrontend{outputs: map[string]string{
+		"sbatch":                "77;cluster\n",
+		"squeue -h -j 77,78 -o": "77 R\n78 PD\n",
+		"squeue -h -j 77 -o %N": "node-3\n",
+		"squeue -h -j 78 -o %N": "\n",
+		"scancel 77":            "",
+	}}
+	scheduler, err := newScheduler(SCHEDULER_SLURM, frontend.run, 90*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobID, err := scheduler.Submit("exp_hi", "debug")
+	if err != nil || jobID != 77 {
+		t.Fatalf("Submit = %d, %v", jobID, err)
+	}
+	if !strings.Contains(frontend.cmds[0], "--time=1:30:00") {
+		t.Errorf("sbatch command: %s", frontend.cmds[0])
+	}
+
+	states, err := scheduler.States([]int{77, 78})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states[77] != "R" || states[78] != "PD" {
+		t.Errorf("States = %v", states)
+	}
+
+	if host, err := scheduler.Host(77); err != nil || host != "node-3" {
+		t.Errorf("Host = %q, %v", host, err)
+	}
+	if _, err := scheduler.Host(78); err == nil {
+		t.Error("Host of a pending job succeeded")
+	}
+
+	if err := scheduler.Cancel(77); err != nil {
+		t.Error(err)
+	}
+}
+
+// fakeScheduler keeps jobs pending for a number of polls and only knows the
+// host of running jobs.
+type fakeScheduler struct {
+	nextID      int
+	pendingFor  int
+	statesCalls int
+}
+
+func (s *fakeScheduler) Submit(name, cluster string) (int, error) {
+	s.nextID++
+	return s.nextID, nil
+}
+
+func (s *fakeScheduler) States(jobIDs []int) (map[int]string, error) {
+	s.statesCalls++
+	state := JOB_STATE_RUNNING
+	if s.statesCalls <= s.pendingFor {
+		state = "PD"
+	}
+	states := map[int]string{}
+	for _, jobID := range jobIDs {
+		states[jobID] = state
+	}
+	return states, nil
+}
+
+func (s *fakeScheduler) Host(jobID int) (string, error) {
+	if s.statesCalls <= s.pendingFor {
+		return "", errors.New("node list not found")
+	}
+	return fmt.Sprintf("node-%d", jobID), nil
+}
+
+func (s *fakeScheduler) Cancel(jobID int) error {
+	return nil
+}
+
+func TestClusterBackendResolvesHostsOnceRunning(t *testing.T) {
+	scheduler := &fakeScheduler{pendingFor: 2}
+	b := newClusterBackend(scheduler, &oarP2PNetwork{}, nil, "moltres", "", "", "")
+	b.pollIntervalS = 0
+
+	jobs := []*Job{}
+	for _, name := range []string{"a", "b", "c"} {
+		job, err := b.Submit(JobPlan{ExperimanetName: name, Protocol: "hi"})
+		if err != nil {
+			t.Fatalf("Submit of a pending job: %v", err)
+		}
+		if job.Host != "" {
+			t.Errorf("Submit resolved host %q of a pending job", job.Host)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := b.WaitRunning(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if scheduler.statesCalls != 3 {
+		t.Errorf("%d States calls for 3 polls", scheduler.statesCalls)
+	}
+	for _, job := range jobs {
+		if job.Host != fmt.Sprintf("node-%d", job.ID) {
+			t.Errorf("job %d has host %q", job.ID, job.Host)
+		}
+	}
+
+	if _, err := b.Reattach(JobPlan{}, 2, jobs[1].Host); err != nil {
+		t.Errorf("Reattach of a running job: %v", err)
+	}
+}
+
+func TestClusterBackendNetworksSlurmJobsOnTheirHost(t *testing.T) {
+	remote := &fakeRemote{uploads: map[string]string{}}
+	b := newClusterBackend(&fakeScheduler{}, &holderNetwork{run: remote.Run}, remote, "moltres", "", "", "")
+	backend = b
+	t.Cleanup(func() { backend = nil })
+
+	job := &Job{JobPlan: JobPlan{ExperimanetName: "dummy", Protocol: "hi", NodesCount: 2, LatencyMS: 20}, ID: 7, Host: "node-7"}
+	if err := b.SetUpNetwork(*job); err != nil {
+		t.Fatal(err)
+	}
+	if len(remote.scripts) != 1 || !strings.HasPrefix(remote.scripts[0], "node-7: ") {
+		t.Fatalf("network set up with %v, want a script on the job host", remote.scripts)
+	}
+	for _, want := range []string{"docker network create --subnet 10.107.0.0/16 hidera_j7", "--ip 10.107.0.3", "netem delay 20ms"} {
+		if !strings.Contains(remote.scripts[0], want) {
+			t.Errorf("network script lacks %q", want)
+		}
+	}
+	if got := containerName(*job, 2); got != "j7_node_2" {
+		t.Errorf("container name %s", got)
+	}
+	if got := b.ContainerNetworkArgs(*job, 2); got != "--network container:j7_net_2" {
+		t.Errorf("container network args %s", got)
+	}
+
+	unscheduled := &Job{JobPlan: JobPlan{ExperimanetName: "pending", Protocol: "hi"}, ID: 8}
+	if err := b.Terminate([]*Job{job, unscheduled}); err != nil {
+		t.Fatal(err)
+	}
+	if len(remote.scripts) != 2 || !strings.Contains(remote.scripts[1], "docker network rm hidera_j7") {
+		t.Errorf("teardown ran %v, want a single script removing the network of the job with a host", remote.scripts[1:])
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// RunState tracks the membership, overlay and input values of a repetition,
+// so that every event computes its ground truth on top of the changes made by
+// the events fired before it.
+type RunState struct {
+	mu         sync.Mutex
+	Repetition int
+	initial    []float64
+	values     map[int]float64
+	dead       map[int]bool
+	partitions [][]int
+	graph      *Graph
+	nextID     int
+	maxID      int
+	rng        *rand.Rand
+	aggregate  func(values []float64) float64
+}
+
+func newRunState(job Job, repetition int, inputs []float64) *RunState {
+	state := &RunState{
+		Repetition: repetition,
+		initial:    inputs,
+		values:     map[int]float64{},
+		dead:       map[int]bool{},
+		graph:      newGraph(job.NodesCount),
+		nextID:     job.NodesCount + 1,
+		maxID:      job.AddressesCount(),
+		rng:        rand.New(rand.NewSource(job.Seed + int64(repetition))),
+		aggregate:  job.aggregateFn(),
+	}
+	for i := range job.NodesCount {
+		id := i + 1
+		state.values[id] = inputs[i]
+		state.graph.Adj[i] = slices.Clone(job.Graph.Adj[i])
+		state.graph.Deg[i] = job.Graph.Deg[i]
+	}
+	return state
+}
+
+func (s *RunState) Kill(nodeIDs []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range nodeIDs {
+		s.dead[id] = true
+	}
+}
+
+// Revive brings killed nodes back, restarted containers start over with
+// their initial input value.
+func (s *RunState) Revive(nodeIDs []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range nodeIDs {
+		delete(s.dead, id)
+		s.values[id] = s.initial[id-1]
+	}
+}
+
+// Initial returns the input value a node starts with.
+func (s *RunState) Initial(nodeID int) float64 {
+	return s.initial[nodeID-1]
+}
+
+// ReserveJoin hands out the ID of the next joining node and picks up to
+// degree random live nodes as its peers. It returns false once every spare
+// address is taken.
+func (s *RunState) ReserveJoin(degree int) (int, []int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nextID > s.maxID {
+		return 0, nil, false
+	}
+	id := s.nextID
+	s.nextID++
+
+	alive := []int{}
+	for nodeID := range s.values {
+		if !s.dead[nodeID] {
+			alive = append(alive, nodeID)
+		}
+	}
+	sort.Ints(alive)
+	s.rng.Shuffle(len(alive), func(i, j int) {
+		alive[i], alive[j] = alive[j], alive[i]
+	})
+	peers := alive[:min(degree, len(alive))]
+	sort.Ints(peers)
+	return id, peers, true
+}
+
+// Join adds a started node to the membership and wires it into the overlay.
+// Only the node is told about its peers, the running peers aren't, so the
+// overlay records the links from the node to them and not back; whether the
+// peers link back is up to the protocol.
+func (s *RunState) Join(nodeID int, peers []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.graph.Adj) < nodeID {
+		s.graph.Adj = append(s.graph.Adj, nil)
+		s.graph.Deg = append(s.graph.Deg, 0)
+	}
+	for _, peer := range peers {
+		s.graph.addArc(nodeID-1, peer-1)
+	}
+	s.values[nodeID] = s.initial[nodeID-1]
+}
+
+func (s *RunState) SetValue(nodeID int, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[nodeID] = value
+}
+
+func (s *RunState) IsAlive(nodeID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.values[nodeID]
+	return ok && !s.dead[nodeID]
+}
+
+// Alive returns the IDs of live nodes in ascending order.
+func (s *RunState) Alive() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alive := []int{}
+	for id := range s.values {
+		if !s.dead[id] {
+			alive = append(alive, id)
+		}
+	}
+	sort.Ints(alive)
+	return alive
+}
+
+// Expected aggregates the input values of live nodes with the plan aggregate.
+func (s *RunState) Expected() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.expected()
+}
+
+func (s *RunState) expected() float64 {
+	ids := []int{}
+	for id := range s.values {
+		ids = append(ids, id)
+	}
+	return s.expectedOf(ids)
+}
+
+func (s *RunState) expectedOf(nodeIDs []int) float64 {
+	values := []float64{}
+	for _, id := range nodeIDs {
+		value, ok := s.values[id]
+		if ok && !s.dead[id] {
+			values = append(values, value)
+		}
+	}
+	return s.aggregate(values)
+}
+
+// Partition records the components the network is split into, nil once it
+// is healed.
+func (s *RunState) Partition(partitions [][]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partitions = partitions
+}
+
+func (s *RunState) IsPartitioned() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.partitions) > 0
+}
+
+// Partitions returns the nodes and the expected value of every component
+// the network is currently split into.
+func (s *RunState) Partitions() []PartitionMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.partitionsMetadata()
+}
+
+func (s *RunState) partitionsMetadata() []PartitionMetadata {
+	if len(s.partitions) == 0 {
+		return nil
+	}
+	partitions := []PartitionMetadata{}
+	for _, nodeIDs := range s.partitions {
+		partitions = append(partitions, PartitionMetadata{
+			Nodes:         nodeIDsToNames(nodeIDs),
+			ExpectedValue: s.expectedOf(nodeIDs),
+		})
+	}
+	return partitions
+}
+
+// Dead returns the IDs of killed nodes in ascending order.
+func (s *RunState) Dead() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deadIDs()
+}
+
+func (s *RunState) deadIDs() []int {
+	ids := []int{}
+	for id, dead := range s.dead {
+		if dead {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// NodeIDs returns the IDs of every node that has been started, dead or alive.
+func (s *RunState) NodeIDs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []int{}
+	for id := range s.values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Graph returns the overlay including the links of joined nodes to their
+// peers.
+func (s *RunState) Graph() Graph {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := Graph{Adj: make([][]int, len(s.graph.Adj)), Deg: slices.Clone(s.graph.Deg)}
+	for i, neighbors := range s.graph.Adj {
+		g.Adj[i] = slices.Clone(neighbors)
+	}
+	return g
+}
+
+// Excluded returns the names of dead nodes, whose output doesn't count.
+func (s *RunState) Excluded() []string {
+	return nodeIDsToNames(s.Dead())
+}
+
+// snapshot describes the state right after an event changed it. It holds
+// the lock throughout, so events firing at the same time can't change the
+// state halfway through.
+func (s *RunState) snapshot(ts int64) EventMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return EventMetadata{
+		EventTs:       ts,
+		ExpectedValue: s.expected(),
+		ExcludeNodes:  nodeIDsToNames(s.deadIDs()),
+		Partitions:    s.partitionsMetadata(),
+	}
+}
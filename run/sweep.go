@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// params that shape the overlay, plans that differ in any of them can't share a graph
+var overlayParams = []string{"nodes_count", "avg_degree", "topology", "topology_params", "seed", "topology_file"}
+
+// params that identify a plan or are derived from it, they can't be swept
+var unsweepableParams = []string{"exp_name", "overlay_group", "sweep", "sweep_name", "sweep_params", "graph", "topology_hash"}
+
+// expandSweeps replaces every plan that declares a sweep with one plan per
+// element of the cartesian product of the swept values.
+func expandSweeps(plans []*JobPlan) ([]*JobPlan, error) {
+	expanded := make([]*JobPlan, 0)
+	for _, plan := range plans {
+		if len(plan.Sweep) == 0 {
+			expanded = append(expanded, plan)
+			continue
+		}
+		sweptPlans, err := expandSweep(plan)
+		if err != nil {
+			return nil, fmt.Errorf("sweep of %s: %w", plan.ExperimanetName, err)
+		}
+		expanded = append(expanded, sweptPlans...)
+	}
+	return expanded, nil
+}
+
+func expandSweep(plan *JobPlan) ([]*JobPlan, error) {
+	base := *plan
+	base.Sweep = nil
+
+	baseJson, err := json.Marshal(&base)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(baseJson, &fields); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(plan.Sweep))
+	for key, values := range plan.Sweep {
+		if _, ok := fields[key]; !ok || slices.Contains(unsweepableParams, key) {
+			return nil, fmt.Errorf("param %s can't be swept", key)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no values for param %s", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	expanded := make([]*JobPlan, 0)
+	for _, combination := range cartesianProduct(keys, plan.Sweep) {
+		for key, value := range combination {
+			fields[key] = value
+		}
+		combinationJson, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		cp := &JobPlan{}
+		if err := json.Unmarshal(combinationJson, cp); err != nil {
+			return nil, err
+		}
+		cp.SweepName = plan.ExperimanetName
+		cp.SweepParams = combination
+		cp.ExperimanetName = plan.ExperimanetName + sweepSuffix(keys, combination)
+		cp.OverlayGroup = plan.OverlayGroup + sweepSuffix(overlayKeys(keys), combination)
+		expanded = append(expanded, cp)
+	}
+	return expanded, nil
+}
+
+func cartesianProduct(keys []string, values map[string][]json.RawMessage) []map[string]json.RawMessage {
+	product := []map[string]json.RawMessage{{}}
+	for _, key := range keys {
+		next := make([]map[string]json.RawMessage, 0, len(product)*len(values[key]))
+		for _, partial := range product {
+			for _, value := range values[key] {
+				combination := make(map[string]json.RawMessage, len(partial)+1)
+				for k, v := range partial {
+					combination[k] = v
+				}
+				combination[key] = value
+				next = append(next, combination)
+			}
+		}
+		product = next
+	}
+	return product
+}
+
+func overlayKeys(keys []string) []string {
+	filtered := []string{}
+	for _, key := range keys {
+		if slices.Contains(overlayParams, key) {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+func sweepSuffix(keys []string, combination map[string]json.RawMessage) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		value := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' {
+				return r
+			}
+			return -1
+		}, string(combination[key]))
+		sb.WriteString(fmt.Sprintf("_%s-%s", key, value))
+	}
+	return sb.String()
+}
@@ -0,0 +1 @@
+# OAR_JOB_ID=1 oar-p2p net up --addresses 4 --latency-matrix DRY_RUN_DIR/golden_hi/network/latency_1.txt
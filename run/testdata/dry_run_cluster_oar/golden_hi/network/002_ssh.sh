@@ -0,0 +1,52 @@
+# ssh host_1 bash -s
+
+docker run --rm -i --net=host --privileged local/oar-p2p-networking bash -s <<'PROFILE'
+set -e
+declare -A PROFILES
+declare -A APPLIED
+PROFILES["ip_1 ip_2"]="delay 0ms loss 20% rate 512kbit"
+PROFILES["ip_1 ip_3"]="delay 0ms 5ms distribution normal loss 2.01%"
+PROFILES["ip_1 ip_4"]="delay 0ms 5ms distribution normal loss 1.25%"
+PROFILES["ip_2 ip_1"]="delay 0ms 5ms distribution normal loss 1%"
+PROFILES["ip_2 ip_3"]="delay 0ms 5ms distribution normal loss 3.02%"
+PROFILES["ip_2 ip_4"]="delay 0ms 5ms distribution normal loss 2.05%"
+PROFILES["ip_3 ip_1"]="delay 0ms 5ms distribution normal loss 3.39%"
+PROFILES["ip_3 ip_2"]="delay 0ms 5ms distribution normal loss 4.4%"
+PROFILES["ip_3 ip_4"]="delay 0ms 5ms distribution normal loss 1.9%"
+PROFILES["ip_4 ip_1"]="delay 0ms 5ms distribution normal loss 1.27%"
+PROFILES["ip_4 ip_2"]="delay 0ms 5ms distribution normal loss 4.27%"
+PROFILES["ip_4 ip_3"]="delay 0ms 5ms distribution normal loss 3.26%"
+
+hex_to_ip() {
+	local h=${1%%/*}
+	printf '%d.%d.%d.%d' 0x${h:0:2} 0x${h:2:2} 0x${h:4:2} 0x${h:6:2}
+}
+for IF in bond0 lo; do
+	declare -A DELAYS=()
+	while read -r line; do
+		if [[ "$line" =~ qdisc[[:space:]]netem[[:space:]]([0-9a-f]+):[[:space:]]parent[[:space:]]([0-9a-f]+:[0-9a-f]+).*delay[[:space:]]([0-9]+)ms ]]; then
+			DELAYS["${BASH_REMATCH[2]}"]="${BASH_REMATCH[1]} ${BASH_REMATCH[3]}"
+		fi
+	done < <(tc qdisc show dev "${IF}")
+	while read -r flowid src dst; do
+		args="${PROFILES["$(hex_to_ip $src) $(hex_to_ip $dst)"]}"
+		qdisc="${DELAYS[$flowid]}"
+		if [[ -z "$args" || -z "$qdisc" ]]; then
+			continue
+		fi
+		read -r handle latency_val <<< "$qdisc"
+		args="${args/delay 0ms/delay ${latency_val}ms}"
+		tc qdisc change dev "${IF}" parent ${flowid} handle ${handle}: netem ${args}
+		APPLIED["$(hex_to_ip $src) $(hex_to_ip $dst)"]=1
+	done < <(tc filter show dev "${IF}" | awk '
+		/flowid/ { for (i = 1; i <= NF; i++) if ($i == "flowid") flowid = $(i + 1); src = ""; dst = "" }
+		/match/ && / at 12/ { src = $2 }
+		/match/ && / at 16/ { dst = $2; if (src != "") print flowid, src, dst }
+	')
+	unset DELAYS
+done
+if [[ ${#APPLIED[@]} -ne 12 ]]; then
+	echo "network profile applied to ${#APPLIED[@]} of 12 links" >&2
+	exit 1
+fi
+PROFILE
@@ -0,0 +1,72 @@
+# ssh host_1 bash -s
+set -e
+
+rm -rf /srv/hidera/experiments/golden_hi/exp_1
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_1
+docker rm -f node_1 >/dev/null 2>&1 || true
+
+docker run -d \
+--name node_1 \
+--network host \
+--memory 250m \
+-e ID=1 \
+-e LISTEN_IP=ip_1 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=2,4 \
+-e PEER_IPS=ip_2,ip_4 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_1:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_2
+docker rm -f node_2 >/dev/null 2>&1 || true
+
+docker run -d \
+--name node_2 \
+--network host \
+--memory 250m \
+-e ID=2 \
+-e LISTEN_IP=ip_2 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=1,3 \
+-e PEER_IPS=ip_1,ip_3 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_2:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_3
+docker rm -f node_3 >/dev/null 2>&1 || true
+
+docker run -d \
+--name node_3 \
+--network host \
+--memory 250m \
+-e ID=3 \
+-e LISTEN_IP=ip_3 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=2,4 \
+-e PEER_IPS=ip_2,ip_4 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_3:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_4
+docker rm -f node_4 >/dev/null 2>&1 || true
+
+docker run -d \
+--name node_4 \
+--network host \
+--memory 250m \
+-e ID=4 \
+-e LISTEN_IP=ip_4 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=3,1 \
+-e PEER_IPS=ip_3,ip_1 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_4:/var/log/hidera" \
+hidera:latest
+
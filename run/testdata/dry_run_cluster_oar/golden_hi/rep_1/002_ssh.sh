@@ -0,0 +1,18 @@
+# ssh host_1 bash -s
+
+docker run --rm -i --net=host --privileged local/oar-p2p-networking bash -s <<'PARTITION'
+set -e
+iptables -D OUTPUT -j HIDERA_PARTITION_1 2>/dev/null || true
+iptables -F HIDERA_PARTITION_1 2>/dev/null || true
+iptables -X HIDERA_PARTITION_1 2>/dev/null || true
+iptables -N HIDERA_PARTITION_1
+iptables -A HIDERA_PARTITION_1 -s ip_1 -d ip_3 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_1 -d ip_4 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_2 -d ip_3 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_2 -d ip_4 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_3 -d ip_1 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_3 -d ip_2 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_4 -d ip_1 -j DROP
+iptables -A HIDERA_PARTITION_1 -s ip_4 -d ip_2 -j DROP
+iptables -I OUTPUT -j HIDERA_PARTITION_1
+PARTITION
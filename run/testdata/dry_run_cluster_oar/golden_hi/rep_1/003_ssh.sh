@@ -0,0 +1,8 @@
+# ssh host_1 bash -s
+
+docker run --rm -i --net=host --privileged local/oar-p2p-networking bash -s <<'PARTITION'
+set -e
+iptables -D OUTPUT -j HIDERA_PARTITION_1 2>/dev/null || true
+iptables -F HIDERA_PARTITION_1 2>/dev/null || true
+iptables -X HIDERA_PARTITION_1 2>/dev/null || true
+PARTITION
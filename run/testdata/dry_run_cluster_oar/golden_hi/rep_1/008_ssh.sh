@@ -0,0 +1,6 @@
+# ssh host_1 bash -s
+set -e
+
+export HIDERA_PROTOCOLS_FILE=/srv/hidera/experiments/golden_hi/protocols.json
+cd /srv/hidera/hidera_eval/analyze && go run . golden /srv/hidera/experiments
+cd /srv/hidera/hidera_eval/plot && source venv/bin/activate && python plot.py  golden /srv/hidera/experiments
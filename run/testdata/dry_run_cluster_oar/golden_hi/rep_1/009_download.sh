@@ -0,0 +1 @@
+# download nova_cluster:/srv/hidera/experiments/golden_plots ../export/
@@ -0,0 +1,5 @@
+# ssh host_1 bash -s
+
+	docker ps -a -q --filter "name=^node_" | xargs -r docker stop
+	docker ps -a -q --filter "name=^node_" | xargs -r docker rm
+	
\ No newline at end of file
@@ -0,0 +1,6 @@
+# ssh nova_cluster bash -s
+
+	export LC_ALL=C LANG=C
+	oarsub -l "{cluster='moltres'}/nodes=1,walltime=12:00" \
+		--project golden_hi 'sleep 43200'
+	
\ No newline at end of file
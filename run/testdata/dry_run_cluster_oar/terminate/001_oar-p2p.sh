@@ -0,0 +1 @@
+# OAR_JOB_ID=1 oar-p2p net down
@@ -0,0 +1,2 @@
+# ssh nova_cluster bash -s
+oardel 1
\ No newline at end of file
@@ -0,0 +1,6 @@
+# bash -s
+docker build -t hidera:latest /srv/hidera/src/hidera
+docker build -t flow_updating:latest /srv/hidera/src/flow_updating
+docker build -t extrema_propagation:latest /srv/hidera/src/extrema_propagation
+docker build -t digest_diffusion:latest /srv/hidera/src/digest_diffusion
+docker build -t rand_reports:latest /srv/hidera/src/randomized_reports
@@ -0,0 +1,71 @@
+# bash -s
+set -e
+
+
+docker ps -a -q --filter "name=^j1_" | xargs -r docker rm -f >/dev/null
+docker network rm hidera_j1 >/dev/null 2>&1 || true
+docker network create --subnet 10.101.0.0/16 hidera_j1 >/dev/null
+docker run -d --name j1_net_1 --network hidera_j1 --ip 10.101.0.2 --cap-add NET_ADMIN nicolaka/netshoot sleep infinity >/dev/null
+docker run -d --name j1_net_2 --network hidera_j1 --ip 10.101.0.3 --cap-add NET_ADMIN nicolaka/netshoot sleep infinity >/dev/null
+docker run -d --name j1_net_3 --network hidera_j1 --ip 10.101.0.4 --cap-add NET_ADMIN nicolaka/netshoot sleep infinity >/dev/null
+docker run -d --name j1_net_4 --network hidera_j1 --ip 10.101.0.5 --cap-add NET_ADMIN nicolaka/netshoot sleep infinity >/dev/null
+docker exec -i j1_net_1 sh -s <<'EOF'
+set -e
+tc qdisc del dev eth0 root 2>/dev/null || true
+tc qdisc add dev eth0 root handle 1: htb default 1
+tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit
+tc class add dev eth0 parent 1: classid 1:b htb rate 10gbit
+tc qdisc add dev eth0 parent 1:b handle b: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.3/32 flowid 1:b
+tc class add dev eth0 parent 1: classid 1:c htb rate 10gbit
+tc qdisc add dev eth0 parent 1:c handle c: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.4/32 flowid 1:c
+tc class add dev eth0 parent 1: classid 1:d htb rate 10gbit
+tc qdisc add dev eth0 parent 1:d handle d: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.5/32 flowid 1:d
+EOF
+docker exec -i j1_net_2 sh -s <<'EOF'
+set -e
+tc qdisc del dev eth0 root 2>/dev/null || true
+tc qdisc add dev eth0 root handle 1: htb default 1
+tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit
+tc class add dev eth0 parent 1: classid 1:a htb rate 10gbit
+tc qdisc add dev eth0 parent 1:a handle a: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.2/32 flowid 1:a
+tc class add dev eth0 parent 1: classid 1:c htb rate 10gbit
+tc qdisc add dev eth0 parent 1:c handle c: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.4/32 flowid 1:c
+tc class add dev eth0 parent 1: classid 1:d htb rate 10gbit
+tc qdisc add dev eth0 parent 1:d handle d: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.5/32 flowid 1:d
+EOF
+docker exec -i j1_net_3 sh -s <<'EOF'
+set -e
+tc qdisc del dev eth0 root 2>/dev/null || true
+tc qdisc add dev eth0 root handle 1: htb default 1
+tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit
+tc class add dev eth0 parent 1: classid 1:a htb rate 10gbit
+tc qdisc add dev eth0 parent 1:a handle a: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.2/32 flowid 1:a
+tc class add dev eth0 parent 1: classid 1:b htb rate 10gbit
+tc qdisc add dev eth0 parent 1:b handle b: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.3/32 flowid 1:b
+tc class add dev eth0 parent 1: classid 1:d htb rate 10gbit
+tc qdisc add dev eth0 parent 1:d handle d: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.5/32 flowid 1:d
+EOF
+docker exec -i j1_net_4 sh -s <<'EOF'
+set -e
+tc qdisc del dev eth0 root 2>/dev/null || true
+tc qdisc add dev eth0 root handle 1: htb default 1
+tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit
+tc class add dev eth0 parent 1: classid 1:a htb rate 10gbit
+tc qdisc add dev eth0 parent 1:a handle a: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.2/32 flowid 1:a
+tc class add dev eth0 parent 1: classid 1:b htb rate 10gbit
+tc qdisc add dev eth0 parent 1:b handle b: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.3/32 flowid 1:b
+tc class add dev eth0 parent 1: classid 1:c htb rate 10gbit
+tc qdisc add dev eth0 parent 1:c handle c: netem delay 50ms loss 10%
+tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst 10.101.0.4/32 flowid 1:c
+EOF
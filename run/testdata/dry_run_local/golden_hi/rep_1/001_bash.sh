@@ -0,0 +1,72 @@
+# bash -s
+set -e
+
+rm -rf /srv/hidera/experiments/golden_hi/exp_1
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_1
+docker rm -f j1_node_1 >/dev/null 2>&1 || true
+
+docker run -d \
+--name j1_node_1 \
+--network container:j1_net_1 \
+--memory 250m \
+-e ID=1 \
+-e LISTEN_IP=10.101.0.2 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=2,4 \
+-e PEER_IPS=10.101.0.3,10.101.0.5 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_1:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_2
+docker rm -f j1_node_2 >/dev/null 2>&1 || true
+
+docker run -d \
+--name j1_node_2 \
+--network container:j1_net_2 \
+--memory 250m \
+-e ID=2 \
+-e LISTEN_IP=10.101.0.3 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=1,3 \
+-e PEER_IPS=10.101.0.2,10.101.0.4 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_2:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_3
+docker rm -f j1_node_3 >/dev/null 2>&1 || true
+
+docker run -d \
+--name j1_node_3 \
+--network container:j1_net_3 \
+--memory 250m \
+-e ID=3 \
+-e LISTEN_IP=10.101.0.4 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=2,4 \
+-e PEER_IPS=10.101.0.3,10.101.0.5 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_3:/var/log/hidera" \
+hidera:latest
+
+mkdir -p /srv/hidera/experiments/golden_hi/exp_1/node_4
+docker rm -f j1_node_4 >/dev/null 2>&1 || true
+
+docker run -d \
+--name j1_node_4 \
+--network container:j1_net_4 \
+--memory 250m \
+-e ID=4 \
+-e LISTEN_IP=10.101.0.5 \
+-e LISTEN_PORT=9000 \
+-e METRICS_PORT=9200 \
+-e PEER_IDS=3,1 \
+-e PEER_IPS=10.101.0.4,10.101.0.2 \
+--env-file "/srv/hidera/experiments/golden_hi/.env" \
+-v "/srv/hidera/experiments/golden_hi/exp_1/node_4:/var/log/hidera" \
+hidera:latest
+
@@ -0,0 +1,43 @@
+# bash -s
+set -e
+
+
+curl -s --retry 10 --retry-connrefused --retry-delay 1 -X POST -H 'Content-Type: text/plain' \
+  --data-binary @- "http://10.101.0.2:9200/metrics" <<'METRICS'
+
+# HELP app_memory_usage_bytes Current memory usage in bytes
+# TYPE app_memory_usage_bytes gauge
+app_memory_usage_bytes 2
+
+METRICS
+
+
+curl -s --retry 10 --retry-connrefused --retry-delay 1 -X POST -H 'Content-Type: text/plain' \
+  --data-binary @- "http://10.101.0.3:9200/metrics" <<'METRICS'
+
+# HELP app_memory_usage_bytes Current memory usage in bytes
+# TYPE app_memory_usage_bytes gauge
+app_memory_usage_bytes 4
+
+METRICS
+
+
+curl -s --retry 10 --retry-connrefused --retry-delay 1 -X POST -H 'Content-Type: text/plain' \
+  --data-binary @- "http://10.101.0.4:9200/metrics" <<'METRICS'
+
+# HELP app_memory_usage_bytes Current memory usage in bytes
+# TYPE app_memory_usage_bytes gauge
+app_memory_usage_bytes 6
+
+METRICS
+
+
+curl -s --retry 10 --retry-connrefused --retry-delay 1 -X POST -H 'Content-Type: text/plain' \
+  --data-binary @- "http://10.101.0.5:9200/metrics" <<'METRICS'
+
+# HELP app_memory_usage_bytes Current memory usage in bytes
+# TYPE app_memory_usage_bytes gauge
+app_memory_usage_bytes 8
+
+METRICS
+
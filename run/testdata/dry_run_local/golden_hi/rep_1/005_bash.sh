@@ -0,0 +1,4 @@
+# bash -s
+set -e
+
+docker kill j1_node_2
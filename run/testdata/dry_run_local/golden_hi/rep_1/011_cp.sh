@@ -0,0 +1 @@
+# cp -r /srv/hidera/experiments/golden_plots ../export/
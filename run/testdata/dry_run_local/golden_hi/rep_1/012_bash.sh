@@ -0,0 +1,5 @@
+# bash -s
+
+	docker ps -a -q --filter "name=^j1_node_" | xargs -r docker stop
+	docker ps -a -q --filter "name=^j1_node_" | xargs -r docker rm
+	
\ No newline at end of file
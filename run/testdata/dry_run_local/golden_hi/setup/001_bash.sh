@@ -0,0 +1,5 @@
+# bash -s
+set -e
+
+rm -rf /srv/hidera/experiments/golden_hi
+mkdir -p /srv/hidera/experiments/golden_hi
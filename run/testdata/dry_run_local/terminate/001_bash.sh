@@ -0,0 +1,6 @@
+# bash -s
+set -e
+
+
+docker ps -a -q --filter "name=^j1_" | xargs -r docker rm -f >/dev/null
+docker network rm hidera_j1 >/dev/null 2>&1 || true
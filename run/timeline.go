@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimelineEntry fires an event at an offset from the experiment start. Params
+// are passed to the event the same way event_params are.
+type TimelineEntry struct {
+	AtS    int               `json:"at"`
+	Event  string            `json:"event"`
+	Params map[string]string `json:"params"`
+}
+
+func isTimelineValid(timeline []TimelineEntry) bool {
+	for _, entry := range timeline {
+		if _, ok := eventFns[entry.Event]; !ok || entry.AtS < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// eventTimeline returns the plan timeline, or a single entry firing the plan
+// event after event_wait when the plan has no timeline.
+func (job Job) eventTimeline() []TimelineEntry {
+	if len(job.Timeline) > 0 {
+		return job.Timeline
+	}
+	return []TimelineEntry{{AtS: job.EventWaitS, Event: job.EventName, Params: job.EventParams}}
+}
+
+// runTimeline fires every entry at its offset from start, concurrently, so a
+// long running event doesn't delay the ones after it. A dry run fires them
+// one after another instead. It blocks until all events are done and returns
+// their metadata ordered by time, together with the time the first event
+// fired, or the time it gave up if ctx was done before that. Once ctx is done
+// no further event fires.
+func runTimeline(ctx context.Context, job Job, state *RunState, timeline []TimelineEntry, start time.Time) ([]EventMetadata, int64) {
+	entries := make([]TimelineEntry, len(timeline))
+	copy(entries, timeline)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].AtS < entries[j].AtS
+	})
+
+	events := []EventMetadata{}
+	if len(entries) == 0 {
+		return events, now().UnixNano()
+	}
+
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	var startEventsTs int64
+	for i, entry := range entries {
+		if !sleepCtx(ctx, start.Add(time.Duration(entry.AtS)*time.Second).Sub(now())) {
+			if i == 0 {
+				startEventsTs = now().UnixNano()
+			}
+			break
+		}
+		if i == 0 {
+			startEventsTs = now().UnixNano()
+		}
+
+		eventsHandler := eventFns[entry.Event]
+		if eventsHandler == nil {
+			continue
+		}
+
+		entryJob := job
+		entryJob.EventParams = entry.Params
+
+		fire := func() {
+			fired := eventsHandler(ctx, entryJob, state)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, event := range fired {
+				event.Name = entry.Event
+				events = append(events, event)
+			}
+		}
+		// a dry run has a single virtual clock, that concurrent events
+		// would move forward in whatever order they get scheduled
+		if dryRun != nil {
+			fire()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fire()
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].EventTs < events[j].EventTs
+	})
+	return events, startEventsTs
+}
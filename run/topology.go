@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+)
+
+const (
+	TOPOLOGY_CHAIN           = "chain"
+	TOPOLOGY_ERDOS_RENYI     = "erdos_renyi"     // params: p
+	TOPOLOGY_BARABASI_ALBERT = "barabasi_albert" // params: m
+	TOPOLOGY_WATTS_STROGATZ  = "watts_strogatz"  // params: k, beta
+	TOPOLOGY_RANDOM_REGULAR  = "random_regular"  // params: d
+	TOPOLOGY_KARY_TREE       = "kary_tree"       // params: k
+	MAX_TOPOLOGY_ATTEMPTS    = 100
+)
+
+var topologyFns = map[string]func(n int, plan JobPlan, rng *rand.Rand) (*Graph, error){
+	TOPOLOGY_ERDOS_RENYI:     BuildErdosRenyi,
+	TOPOLOGY_BARABASI_ALBERT: BuildBarabasiAlbert,
+	TOPOLOGY_WATTS_STROGATZ:  BuildWattsStrogatz,
+	TOPOLOGY_RANDOM_REGULAR:  BuildRandomRegular,
+	TOPOLOGY_KARY_TREE:       BuildKaryTree,
+}
+
+func isTopologyValid(topology string) bool {
+	_, ok := topologyFns[topology]
+	return ok || topology == "" || topology == TOPOLOGY_CHAIN
+}
+
+// BuildTopology builds the overlay selected by the plan. Random topologies
+// are seeded by the plan seed, their nodes are shuffled so that no node has a
+// fixed position, and graphs that are not connected are regenerated until
+// the attempts run out.
+func BuildTopology(plan JobPlan) (*Graph, error) {
+	if plan.Topology == "" || plan.Topology == TOPOLOGY_CHAIN {
+		return BuildGraph(plan.NodesCount, plan.AvgDegree), nil
+	}
+
+	buildFn, ok := topologyFns[plan.Topology]
+	if !ok {
+		return nil, fmt.Errorf("unknown topology %s", plan.Topology)
+	}
+
+	rng := rand.New(rand.NewSource(plan.Seed))
+	for range MAX_TOPOLOGY_ATTEMPTS {
+		g, err := buildFn(plan.NodesCount, plan, rng)
+		if err != nil {
+			return nil, err
+		}
+		if g.isConnected() {
+			return g.shuffle(rng), nil
+		}
+	}
+	return nil, fmt.Errorf("no connected %s graph in %d attempts", plan.Topology, MAX_TOPOLOGY_ATTEMPTS)
+}
+
+func BuildErdosRenyi(n int, plan JobPlan, rng *rand.Rand) (*Graph, error) {
+	p := float64(plan.AvgDegree) / float64(max(n-1, 1))
+	p, err := floatTopologyParam(plan, "p", p)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newGraph(n)
+	for u := range n {
+		for v := u + 1; v < n; v++ {
+			if rng.Float64() < p {
+				g.addEdge(u, v)
+			}
+		}
+	}
+	return g, nil
+}
+
+func BuildBarabasiAlbert(n int, plan JobPlan, rng *rand.Rand) (*Graph, error) {
+	m, err := intTopologyParam(plan, "m", max(plan.AvgDegree/2, 1))
+	if err != nil {
+		return nil, err
+	}
+	if m < 1 || m >= n {
+		return nil, fmt.Errorf("barabasi_albert: m must be in [1, %d), got %d", n, m)
+	}
+
+	g := newGraph(n)
+	// every endpoint of every edge, so sampling from it is proportional to degree
+	endpoints := []int{}
+	for u := range m + 1 {
+		for v := u + 1; v <= m; v++ {
+			g.addEdge(u, v)
+			endpoints = append(endpoints, u, v)
+		}
+	}
+	for u := m + 1; u < n; u++ {
+		targets := []int{}
+		for len(targets) < m {
+			v := endpoints[rng.Intn(len(endpoints))]
+			if !slices.Contains(targets, v) {
+				targets = append(targets, v)
+			}
+		}
+		for _, v := range targets {
+			g.addEdge(u, v)
+			endpoints = append(endpoints, u, v)
+		}
+	}
+	return g, nil
+}
+
+func BuildWattsStrogatz(n int, plan JobPlan, rng *rand.Rand) (*Graph, error) {
+	k, err := intTopologyParam(plan, "k", plan.AvgDegree)
+	if err != nil {
+		return nil, err
+	}
+	beta, err := floatTopologyParam(plan, "beta", 0.1)
+	if err != nil {
+		return nil, err
+	}
+	k -= k % 2
+	if k < 2 || k >= n {
+		return nil, fmt.Errorf("watts_strogatz: k must be even and in [2, %d), got %d", n, k)
+	}
+
+	g := newGraph(n)
+	for u := range n {
+		for j := 1; j <= k/2; j++ {
+			v := (u + j) % n
+			if rng.Float64() < beta && g.Deg[u] < n-1 {
+				w := rng.Intn(n)
+				for w == u || g.isNeighbor(u, w) {
+					w = rng.Intn(n)
+				}
+				v = w
+			}
+			if !g.isNeighbor(u, v) {
+				g.addEdge(u, v)
+			}
+		}
+	}
+	return g, nil
+}
+
+// BuildRandomRegular pairs the d stubs of every node at random, like the
+// configuration model, and repairs the self loops and parallel edges of the
+// pairing by switching each of them with a random other pair. Discarding
+// pairings that aren't simple would almost never succeed for d above 5.
+func BuildRandomRegular(n int, plan JobPlan, rng *rand.Rand) (*Graph, error) {
+	d, err := intTopologyParam(plan, "d", plan.AvgDegree)
+	if err != nil {
+		return nil, err
+	}
+	if d < 1 || d >= n || (n*d)%2 != 0 {
+		return nil, fmt.Errorf("random_regular: no %d-regular graph on %d nodes", d, n)
+	}
+
+	for range MAX_TOPOLOGY_ATTEMPTS {
+		if pairs, ok := randomSimplePairing(n, d, rng); ok {
+			g := newGraph(n)
+			for _, pair := range pairs {
+				g.addEdge(pair[0], pair[1])
+			}
+			return g, nil
+		}
+	}
+	return nil, errors.New("random_regular: no simple pairing found")
+}
+
+// randomSimplePairing returns the edges of a random d-regular simple graph,
+// or false if switching the pairs that aren't simple runs out of attempts.
+// A switch replaces the pairs (u,v) and (x,y) by (u,x) and (v,y), and is only
+// made if both new pairs are simple edges that aren't in the graph yet, so
+// the pairs that are fixed stay fixed.
+func randomSimplePairing(n, d int, rng *rand.Rand) ([][2]int, bool) {
+	stubs := make([]int, 0, n*d)
+	for u := range n {
+		for range d {
+			stubs = append(stubs, u)
+		}
+	}
+	rng.Shuffle(len(stubs), func(i, j int) {
+		stubs[i], stubs[j] = stubs[j], stubs[i]
+	})
+
+	edge := func(u, v int) [2]int {
+		return [2]int{min(u, v), max(u, v)}
+	}
+	pairs := make([][2]int, 0, len(stubs)/2)
+	multiplicity := map[[2]int]int{}
+	for i := 0; i < len(stubs); i += 2 {
+		pair := edge(stubs[i], stubs[i+1])
+		pairs = append(pairs, pair)
+		multiplicity[pair]++
+	}
+	isSimple := func(pair [2]int) bool {
+		return pair[0] != pair[1] && multiplicity[pair] == 1
+	}
+
+	switches := MAX_TOPOLOGY_ATTEMPTS * len(pairs)
+	for i := range pairs {
+		for !isSimple(pairs[i]) {
+			if switches == 0 {
+				return nil, false
+			}
+			switches--
+
+			j := rng.Intn(len(pairs))
+			u, v := pairs[i][0], pairs[i][1]
+			x, y := pairs[j][0], pairs[j][1]
+			if rng.Intn(2) == 0 {
+				x, y = y, x
+			}
+			first, second := edge(u, x), edge(v, y)
+			if j == i || u == x || v == y || first == second {
+				continue
+			}
+			multiplicity[pairs[i]]--
+			multiplicity[pairs[j]]--
+			if multiplicity[first] > 0 || multiplicity[second] > 0 {
+				multiplicity[pairs[i]]++
+				multiplicity[pairs[j]]++
+				continue
+			}
+			pairs[i], pairs[j] = first, second
+			multiplicity[first]++
+			multiplicity[second]++
+		}
+	}
+	return pairs, true
+}
+
+func BuildKaryTree(n int, plan JobPlan, rng *rand.Rand) (*Graph, error) {
+	k, err := intTopologyParam(plan, "k", max(plan.AvgDegree-1, 2))
+	if err != nil {
+		return nil, err
+	}
+	if k < 1 {
+		return nil, fmt.Errorf("kary_tree: k must be positive, got %d", k)
+	}
+
+	g := newGraph(n)
+	for u := 1; u < n; u++ {
+		g.addEdge(u, (u-1)/k)
+	}
+	return g, nil
+}
+
+func intTopologyParam(plan JobPlan, name string, def int) (int, error) {
+	str, ok := plan.TopologyParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("topology param %s: %w", name, err)
+	}
+	return value, nil
+}
+
+func floatTopologyParam(plan JobPlan, name string, def float64) (float64, error) {
+	str, ok := plan.TopologyParams[name]
+	if !ok {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("topology param %s: %w", name, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TOPOLOGY_FORMAT_EDGE_LIST = "edgelist"
+	TOPOLOGY_FORMAT_GRAPHML   = "graphml"
+	TOPOLOGY_FORMAT_DOT       = "dot"
+)
+
+// LoadTopologyFile parses an overlay snapshot into a graph with exactly
+// count nodes and returns it together with the SHA-256 of the file. Node
+// labels are mapped to indices in the order of their numeric suffix, or
+// lexicographically if some label has none.
+func LoadTopologyFile(path string, count int) (*Graph, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(content)
+
+	var edges [][2]string
+	var labels []string
+	switch topologyFileFormat(path) {
+	case TOPOLOGY_FORMAT_GRAPHML:
+		labels, edges, err = parseGraphML(content)
+	case TOPOLOGY_FORMAT_DOT:
+		labels, edges, err = parseDOT(content)
+	default:
+		labels, edges, err = parseEdgeList(content)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("topology file %s: %w", path, err)
+	}
+
+	indices := indexLabels(labels, edges)
+	if len(indices) != count {
+		return nil, "", fmt.Errorf("topology file %s: has %d nodes, plan expects %d", path, len(indices), count)
+	}
+
+	g := newGraph(count)
+	for _, edge := range edges {
+		u, v := indices[edge[0]], indices[edge[1]]
+		if u == v || g.isNeighbor(u, v) {
+			continue
+		}
+		g.addEdge(u, v)
+	}
+	if !g.isConnected() {
+		return nil, "", fmt.Errorf("topology file %s: graph is not connected", path)
+	}
+
+	return g, hex.EncodeToString(hash[:]), nil
+}
+
+func topologyFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".graphml", ".xml":
+		return TOPOLOGY_FORMAT_GRAPHML
+	case ".dot", ".gv":
+		return TOPOLOGY_FORMAT_DOT
+	}
+	return TOPOLOGY_FORMAT_EDGE_LIST
+}
+
+var labelNumberRegex = regexp.MustCompile(`([0-9]+)$`)
+
+func indexLabels(labels []string, edges [][2]string) map[string]int {
+	set := map[string]struct{}{}
+	for _, label := range labels {
+		set[label] = struct{}{}
+	}
+	for _, edge := range edges {
+		set[edge[0]] = struct{}{}
+		set[edge[1]] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(set))
+	numbers := map[string]int{}
+	numeric := true
+	for label := range set {
+		sorted = append(sorted, label)
+		match := labelNumberRegex.FindString(label)
+		number, err := strconv.Atoi(match)
+		if err != nil {
+			numeric = false
+			continue
+		}
+		numbers[label] = number
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if numeric && numbers[sorted[i]] != numbers[sorted[j]] {
+			return numbers[sorted[i]] < numbers[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	indices := make(map[string]int, len(sorted))
+	for i, label := range sorted {
+		indices[label] = i
+	}
+	return indices
+}
+
+// parseEdgeList reads one "u v" pair per line, separated by whitespace or
+// commas. Further columns (weights) are ignored, # and % start comments and
+// a line with a single label declares an isolated node.
+func parseEdgeList(content []byte) ([]string, [][2]string, error) {
+	labels := []string{}
+	edges := [][2]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "%") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			labels = append(labels, fields[0])
+		default:
+			edges = append(edges, [2]string{fields[0], fields[1]})
+		}
+	}
+	return labels, edges, scanner.Err()
+}
+
+type graphML struct {
+	Graphs []struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func parseGraphML(content []byte) ([]string, [][2]string, error) {
+	var doc graphML
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Graphs) == 0 {
+		return nil, nil, errors.New("no graph element")
+	}
+
+	labels := []string{}
+	edges := [][2]string{}
+	for _, graph := range doc.Graphs {
+		for _, node := range graph.Nodes {
+			labels = append(labels, node.ID)
+		}
+		for _, edge := range graph.Edges {
+			edges = append(edges, [2]string{edge.Source, edge.Target})
+		}
+	}
+	return labels, edges, nil
+}
+
+var (
+	dotCommentRegex   = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*|(?m)^\s*#[^\n]*`)
+	dotAttributeRegex = regexp.MustCompile(`(?s)\[[^\]]*\]`)
+	dotEdgeOpRegex    = regexp.MustCompile(`--|->`)
+)
+
+// parseDOT understands the subset of DOT that overlay dumps use: node and
+// edge statements, edge chains and attribute lists, which are ignored.
+// Subgraphs are flattened.
+func parseDOT(content []byte) ([]string, [][2]string, error) {
+	body := dotAttributeRegex.ReplaceAllString(string(content), "")
+	body = dotCommentRegex.ReplaceAllString(body, "")
+
+	start := strings.Index(body, "{")
+	end := strings.LastIndex(body, "}")
+	if start < 0 || end < start {
+		return nil, nil, errors.New("no graph body")
+	}
+	body = body[start+1 : end]
+	body = strings.NewReplacer("{", ";", "}", ";").Replace(body)
+
+	labels := []string{}
+	edges := [][2]string{}
+	for _, statement := range strings.FieldsFunc(body, func(r rune) bool {
+		return r == ';' || r == '\n'
+	}) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" || strings.Contains(statement, "=") {
+			continue
+		}
+		parts := dotEdgeOpRegex.Split(statement, -1)
+		ids := make([]string, 0, len(parts))
+		for _, part := range parts {
+			id := strings.Trim(strings.TrimSpace(part), `"`)
+			if strings.HasPrefix(id, "subgraph") {
+				continue
+			}
+			if id == "" || id == "node" || id == "edge" || id == "graph" {
+				ids = nil
+				break
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 1 {
+			labels = append(labels, ids[0])
+		}
+		for i := 1; i < len(ids); i++ {
+			edges = append(edges, [2]string{ids[i-1], ids[i]})
+		}
+	}
+	return labels, edges, nil
+}
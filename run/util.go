@@ -1,26 +1,16 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func executeRemoteCmd(remoteCmd string) (string, error) {
-	cmd := exec.Command("ssh", FRONTEND_HOSTNAME, remoteCmd)
-
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = nil
-
-	err := cmd.Run()
-
-	return stdout.String(), err
-}
-
 func extractJobID(out string) (int, error) {
 	re := regexp.MustCompile(`[0-9]+`)
 	matches := re.FindAllString(out, -1)
@@ -33,9 +23,8 @@ func extractJobID(out string) (int, error) {
 	return strconv.Atoi(jobIDStr)
 }
 
-func extractJobStates(out string) []string {
+func extractJobState(out string, jobID int) (string, error) {
 	lines := strings.Split(out, "\n")
-	var states []string
 
 	for i, line := range lines {
 		if i < 2 || strings.TrimSpace(line) == "" {
@@ -43,12 +32,12 @@ func extractJobStates(out string) []string {
 		}
 
 		fields := strings.Fields(line)
-		if len(fields) >= 2 {
-			states = append(states, fields[1])
+		if len(fields) >= 2 && fields[0] == strconv.Itoa(jobID) {
+			return fields[1], nil
 		}
 	}
 
-	return states
+	return "", fmt.Errorf("job %d not found", jobID)
 }
 
 func extractHost(out string) (string, error) {
@@ -71,6 +60,51 @@ func extractHost(out string) (string, error) {
 	return address, nil
 }
 
+// runCmd runs a command on this machine, or records it in a dry run.
+func runCmd(cmd *exec.Cmd) error {
+	if dryRun != nil {
+		return dryRun.recordCmd(cmd)
+	}
+	return cmd.Run()
+}
+
+// now is the time on the clock of the run, which is virtual in a dry run.
+func now() time.Time {
+	if dryRun != nil {
+		return dryRun.now()
+	}
+	return time.Now()
+}
+
+// sleepCtx sleeps for d unless ctx is done first, and reports whether it
+// slept the whole duration.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if dryRun != nil {
+		return dryRun.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// shellQuote quotes arg for bash if it needs quoting.
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"$\\{}()[]<>|&;*?!#~`") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func nodeName(id int) string {
+	return fmt.Sprintf("node_%d", id)
+}
+
 func allEqual(states []string, state string) bool {
 	for _, s := range states {
 		if s != state {